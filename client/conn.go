@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	_ "google.golang.org/grpc/health" // registers client side health checking
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrConnClosing = errors.New("frontier connection is closing")
+
+	// DefaultKeepaliveParams pings idle connections so broken links
+	// behind load balancers are detected before the next request
+	DefaultKeepaliveParams = keepalive.ClientParameters{
+		Time:                time.Second * 30,
+		Timeout:             time.Second * 10,
+		PermitWithoutStream: true,
+	}
+
+	// DefaultServiceConfig balances calls across all resolved frontier
+	// addresses, only picks backends that report healthy and retries
+	// UNAVAILABLE read calls
+	DefaultServiceConfig = NewServiceConfig(pkg.DefaultRetryPolicy, 0)
+)
+
+// readMethodPrefixes are name prefixes of frontier rpcs without side effects
+var readMethodPrefixes = []string{"Get", "List", "Check", "Describe"}
+
+// NewServiceConfig builds a grpc service config json with round-robin load
+// balancing, health checking, retries as per policy and a per call timeout.
+// UNAVAILABLE may be returned after frontier has processed a call, e.g.
+// while it shuts down, so only read rpcs like Get*, List* and Check* are
+// retried. Calls that create, update or delete are never retried.
+func NewServiceConfig(policy pkg.RetryPolicy, timeout time.Duration) string {
+	type retryPolicy struct {
+		MaxAttempts          int      `json:"maxAttempts"`
+		InitialBackoff       string   `json:"initialBackoff"`
+		MaxBackoff           string   `json:"maxBackoff"`
+		BackoffMultiplier    float64  `json:"backoffMultiplier"`
+		RetryableStatusCodes []string `json:"retryableStatusCodes"`
+	}
+	type methodConfig struct {
+		Name        []map[string]string `json:"name"`
+		Timeout     string              `json:"timeout,omitempty"`
+		RetryPolicy *retryPolicy        `json:"retryPolicy,omitempty"`
+	}
+	type retryThrottling struct {
+		MaxTokens  float64 `json:"maxTokens"`
+		TokenRatio float64 `json:"tokenRatio"`
+	}
+	cfg := struct {
+		LoadBalancingConfig []map[string]any  `json:"loadBalancingConfig"`
+		HealthCheckConfig   map[string]string `json:"healthCheckConfig"`
+		MethodConfig        []methodConfig    `json:"methodConfig"`
+		RetryThrottling     *retryThrottling  `json:"retryThrottling,omitempty"`
+	}{
+		LoadBalancingConfig: []map[string]any{{"round_robin": map[string]any{}}},
+		HealthCheckConfig:   map[string]string{"serviceName": ""},
+	}
+
+	// a method name takes precedence over its service, so read rpcs get the
+	// retry policy and everything else only the timeout
+	mc := methodConfig{
+		Name: []map[string]string{
+			{"service": frontierv1beta1.FrontierService_ServiceDesc.ServiceName},
+			{"service": frontierv1beta1.AdminService_ServiceDesc.ServiceName},
+		},
+	}
+	if timeout > 0 {
+		mc.Timeout = durationToJSON(timeout)
+	}
+	cfg.MethodConfig = []methodConfig{mc}
+	if policy.MaxAttempts > 1 {
+		read := methodConfig{Name: readMethods(), Timeout: mc.Timeout}
+		multiplier := policy.Multiplier
+		if multiplier <= 0 {
+			multiplier = 1
+		}
+		read.RetryPolicy = &retryPolicy{
+			MaxAttempts:          policy.MaxAttempts,
+			InitialBackoff:       durationToJSON(policy.InitialBackoff),
+			MaxBackoff:           durationToJSON(policy.MaxBackoff),
+			BackoffMultiplier:    multiplier,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}
+		if policy.BudgetRatio > 0 {
+			maxTokens := float64(policy.BudgetMinRetries)
+			if maxTokens < 1 {
+				maxTokens = 1
+			}
+			cfg.RetryThrottling = &retryThrottling{
+				MaxTokens:  maxTokens,
+				TokenRatio: policy.BudgetRatio,
+			}
+		}
+		cfg.MethodConfig = append(cfg.MethodConfig, read)
+	}
+
+	// only fixed types are marshalled, this can't fail
+	b, _ := json.Marshal(cfg)
+	return string(b)
+}
+
+// readMethods returns service config names of frontier and admin read rpcs
+func readMethods() []map[string]string {
+	var names []map[string]string
+	for _, desc := range []*grpc.ServiceDesc{&frontierv1beta1.FrontierService_ServiceDesc, &frontierv1beta1.AdminService_ServiceDesc} {
+		for _, method := range desc.Methods {
+			for _, prefix := range readMethodPrefixes {
+				if strings.HasPrefix(method.MethodName, prefix) {
+					names = append(names, map[string]string{"service": desc.ServiceName, "method": method.MethodName})
+					break
+				}
+			}
+		}
+	}
+	return names
+}
+
+// durationToJSON formats duration as protobuf json duration, e.g. "1.5s"
+func durationToJSON(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+}
+
+// Conn is a single connection to frontier shared by all service clients.
+// Use Dial to create one and Close it once the application shuts down.
+type Conn struct {
+	cc *grpc.ClientConn
+
+	Frontier frontierv1beta1.FrontierServiceClient
+	Admin    frontierv1beta1.AdminServiceClient
+
+	mu       sync.RWMutex
+	closing  bool
+	inflight sync.WaitGroup
+	close    sync.Once
+	closeErr error
+}
+
+// Dial connects to frontier grpc server at host. Keepalive, load balancing
+// and health checking are configured by default and can be overridden by opts.
+// If opts are not provided, DefaultDialOpts are used.
+func Dial(ctx context.Context, host string, opts ...grpc.DialOption) (*Conn, error) {
+	if len(opts) == 0 {
+		opts = DefaultDialOpts
+	}
+	return dial(ctx, host, DialTimeout, opts...)
+}
+
+func dial(ctx context.Context, host string, timeout time.Duration, opts ...grpc.DialOption) (*Conn, error) {
+	c := &Conn{}
+	dialOpts := []grpc.DialOption{
+		grpc.WithKeepaliveParams(DefaultKeepaliveParams),
+		grpc.WithDefaultServiceConfig(DefaultServiceConfig),
+		grpc.WithChainUnaryInterceptor(c.unaryInterceptor),
+		grpc.WithChainStreamInterceptor(c.streamInterceptor),
+	}
+	dialOpts = append(dialOpts, opts...)
+
+	dialTimeoutCtx, dialCancel := context.WithTimeout(ctx, timeout)
+	defer dialCancel()
+	cc, err := grpc.DialContext(dialTimeoutCtx, host, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+	c.cc = cc
+	c.Frontier = frontierv1beta1.NewFrontierServiceClient(cc)
+	c.Admin = frontierv1beta1.NewAdminServiceClient(cc)
+	return c, nil
+}
+
+// ClientConn returns the underlying grpc connection
+func (c *Conn) ClientConn() *grpc.ClientConn {
+	return c.cc
+}
+
+// Close stops accepting new calls, waits for in-flight calls to finish
+// and closes the underlying connection. It is safe to call multiple times.
+func (c *Conn) Close() error {
+	return c.Shutdown(context.Background())
+}
+
+// Shutdown is like Close but gives up waiting for in-flight calls once ctx
+// is done, in which case remaining calls are cancelled.
+func (c *Conn) Shutdown(ctx context.Context) error {
+	c.close.Do(func() {
+		c.mu.Lock()
+		c.closing = true
+		c.mu.Unlock()
+
+		drained := make(chan struct{})
+		go func() {
+			c.inflight.Wait()
+			close(drained)
+		}()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+		}
+		c.closeErr = c.cc.Close()
+	})
+	return c.closeErr
+}
+
+func (c *Conn) acquire() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closing {
+		return false
+	}
+	c.inflight.Add(1)
+	return true
+}
+
+func (c *Conn) unaryInterceptor(ctx context.Context, method string, req, reply any,
+	cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if !c.acquire() {
+		return status.Error(codes.Unavailable, ErrConnClosing.Error())
+	}
+	defer c.inflight.Done()
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func (c *Conn) streamInterceptor(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+	method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	if !c.acquire() {
+		return nil, status.Error(codes.Unavailable, ErrConnClosing.Error())
+	}
+	s, err := streamer(ctx, desc, cc, method, opts...)
+	if err != nil {
+		c.inflight.Done()
+		return nil, err
+	}
+	ts := &trackedStream{ClientStream: s, done: c.inflight.Done}
+	go func() {
+		<-s.Context().Done()
+		ts.finish()
+	}()
+	return ts, nil
+}
+
+// trackedStream marks a stream as finished once it returns an error
+// (including io.EOF) or its context ends
+type trackedStream struct {
+	grpc.ClientStream
+	done func()
+	once sync.Once
+}
+
+func (s *trackedStream) finish() {
+	s.once.Do(s.done)
+}
+
+func (s *trackedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		s.finish()
+	}
+	return err
+}
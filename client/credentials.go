@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+	"golang.org/x/oauth2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// tokenSourceCredentials attaches a bearer token from ts to every rpc
+type tokenSourceCredentials struct {
+	ts         oauth2.TokenSource
+	requireTLS bool
+}
+
+// NewTokenSourceCredentials authenticates rpcs with tokens of ts, e.g. a
+// pkg.ServiceUserTokenSource. Tokens are only sent over TLS unless
+// requireTLS is false, which is meant for local development.
+func NewTokenSourceCredentials(ts oauth2.TokenSource, requireTLS bool) credentials.PerRPCCredentials {
+	return tokenSourceCredentials{ts: ts, requireTLS: requireTLS}
+}
+
+// WithTokenSource authenticates all rpcs of the connection with ts over TLS
+func WithTokenSource(ts oauth2.TokenSource) grpc.DialOption {
+	return grpc.WithPerRPCCredentials(NewTokenSourceCredentials(ts, true))
+}
+
+func (c tokenSourceCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	token, err := c.ts.Token()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"authorization": token.Type() + " " + token.AccessToken,
+	}, nil
+}
+
+func (c tokenSourceCredentials) RequireTransportSecurity() bool {
+	return c.requireTLS
+}
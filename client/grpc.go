@@ -2,65 +2,108 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
 	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
-	"net/http"
 	"time"
 )
 
 var (
-	DialTimeout     = time.Second * 5
-	DefaultDialOpts = []grpc.DialOption{
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	DialTimeout = time.Second * 5
+
+	// DefaultDialOpts dials frontier over TLS verifying the server
+	// certificate against the system cert pool
+	DefaultDialOpts = DialOptsWithCredentials(credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}))
+
+	// InsecureDialOpts dials frontier over plaintext, only meant for
+	// local development or deployments where TLS is terminated by a sidecar
+	InsecureDialOpts = DialOptsWithCredentials(insecure.NewCredentials())
+)
+
+// DialOptsWithCredentials returns the default set of dial options using
+// provided transport credentials, see NewTLSCredentials for TLS and mTLS
+func DialOptsWithCredentials(creds credentials.TransportCredentials) []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
 		grpc.WithBlock(),
 		grpc.WithDefaultCallOptions(
 			grpc.MaxCallRecvMsgSize(5<<20), // 5MB
 			grpc.MaxCallSendMsgSize(5<<20), // 5MB
 		),
 	}
-)
+}
 
-// GetHeadersAsMetadata converts request headers to grpc metadata
-// useful for passing auth headers, cookies to auth server
-func GetHeadersAsMetadata(r *http.Request) metadata.MD {
-	md := metadata.MD{}
-	for k, v := range r.Header {
-		md.Set(k, v[0])
+// SecureDialOpts builds dial options with TLS credentials configured via options
+// For e.g. SecureDialOpts(WithCACertFile("ca.pem"), WithClientCertFile("tls.crt", "tls.key"))
+func SecureDialOpts(opts ...func(*TLSOptions)) ([]grpc.DialOption, error) {
+	creds, err := NewTLSCredentials(opts...)
+	if err != nil {
+		return nil, err
 	}
-	return md
+	return DialOptsWithCredentials(creds), nil
 }
 
+// CreateBaseClient dials frontier and returns frontier service client.
+// Prefer Dial when both frontier and admin clients are needed so they share a connection.
 func CreateBaseClient(ctx context.Context, host string, opts ...grpc.DialOption) (frontierv1beta1.FrontierServiceClient, func(), error) {
-	dialTimeoutCtx, dialCancel := context.WithTimeout(ctx, DialTimeout)
-	conn, err := grpc.DialContext(dialTimeoutCtx, host, opts...)
+	conn, err := Dial(ctx, host, opts...)
 	if err != nil {
-		dialCancel()
 		return nil, nil, err
 	}
-	cancel := func() {
-		dialCancel()
-		conn.Close()
-	}
-
-	client := frontierv1beta1.NewFrontierServiceClient(conn)
-	client.GetCurrentUser(ctx, &frontierv1beta1.GetCurrentUserRequest{}, grpc.Header(&metadata.MD{}))
-	return client, cancel, nil
+	return conn.Frontier, func() { _ = conn.Close() }, nil
 }
 
+// CreateAdminClient dials frontier and returns admin service client.
+// Prefer Dial when both frontier and admin clients are needed so they share a connection.
 func CreateAdminClient(ctx context.Context, host string, opts ...grpc.DialOption) (frontierv1beta1.AdminServiceClient, func(), error) {
-	dialTimeoutCtx, dialCancel := context.WithTimeout(ctx, DialTimeout)
-	conn, err := grpc.DialContext(dialTimeoutCtx, host, opts...)
+	conn, err := Dial(ctx, host, opts...)
 	if err != nil {
-		dialCancel()
 		return nil, nil, err
 	}
-	cancel := func() {
-		dialCancel()
-		conn.Close()
+	return conn.Admin, func() { _ = conn.Close() }, nil
+}
+
+// DialConfig connects to frontier grpc endpoint of cfg over TLS, or
+// plaintext if cfg.GRPCInsecure is set, presenting cfg.CertFile when
+// frontier requires mTLS. Config timeouts are applied and
+// opts are appended to the derived dial options.
+func DialConfig(ctx context.Context, cfg pkg.Config, opts ...grpc.DialOption) (*Conn, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.GRPCEndpoint == "" {
+		return nil, fmt.Errorf("%w: grpc_endpoint: required to dial (%s)", pkg.ErrInvalidConfig, pkg.EnvGRPCEndpoint)
 	}
 
-	client := frontierv1beta1.NewAdminServiceClient(conn)
-	return client, cancel, nil
+	dialOpts := append([]grpc.DialOption(nil), InsecureDialOpts...)
+	if !cfg.GRPCInsecure {
+		var tlsOpts []func(*TLSOptions)
+		if cfg.CACertFile != "" {
+			tlsOpts = append(tlsOpts, WithCACertFile(cfg.CACertFile))
+		}
+		if cfg.CertFile != "" {
+			tlsOpts = append(tlsOpts, WithClientCertFile(cfg.CertFile, cfg.KeyFile))
+		}
+		if cfg.CertReloadInterval > 0 {
+			tlsOpts = append(tlsOpts, WithCertReloadInterval(cfg.CertReloadInterval))
+		}
+		var err error
+		if dialOpts, err = SecureDialOpts(tlsOpts...); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.CallTimeout > 0 {
+		dialOpts = append(dialOpts, grpc.WithDefaultServiceConfig(NewServiceConfig(pkg.DefaultRetryPolicy, cfg.CallTimeout)))
+	}
+	timeout := DialTimeout
+	if cfg.DialTimeout > 0 {
+		timeout = cfg.DialTimeout
+	}
+	return dial(ctx, cfg.GRPCEndpoint, timeout, append(dialOpts, opts...)...)
 }
@@ -0,0 +1,42 @@
+package client
+
+import (
+	"context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs failed frontier rpcs. Denials are logged at info,
+// infrastructure failures at error. Request metadata is never logged
+// as it carries tokens and cookies.
+func WithLogger(logger *slog.Logger) grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any,
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		if err != nil {
+			code := status.Code(err)
+			logger.LogAttrs(ctx, levelForCode(code), "frontier rpc failed",
+				slog.String("method", method),
+				slog.String("code", code.String()),
+				slog.Duration("latency", time.Since(start)),
+				slog.Any("error", err),
+			)
+		}
+		return err
+	})
+}
+
+func levelForCode(code codes.Code) slog.Level {
+	switch code {
+	case codes.Unauthenticated, codes.PermissionDenied, codes.NotFound,
+		codes.InvalidArgument, codes.AlreadyExists, codes.FailedPrecondition:
+		return slog.LevelInfo
+	case codes.Canceled:
+		return slog.LevelDebug
+	}
+	return slog.LevelError
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"github.com/raystack/frontier-go/pkg"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+var (
+	// DefaultForwardedHeaders are request headers forwarded to frontier as
+	// grpc metadata, everything else is dropped
+	DefaultForwardedHeaders = []string{
+		"Authorization",
+		pkg.DefaultUserTokenHeader,
+		"Cookie",
+		// tracing
+		"Traceparent",
+		"Tracestate",
+		"Baggage",
+		"B3",
+		"X-B3-Traceid",
+		"X-B3-Spanid",
+		"X-B3-Parentspanid",
+		"X-B3-Sampled",
+		"X-B3-Flags",
+		"Uber-Trace-Id",
+		"X-Request-Id",
+	}
+
+	// ForwardedCookies are the only cookies kept in forwarded Cookie header
+	ForwardedCookies = []string{
+		pkg.DefaultSessionID,
+	}
+
+	// unsafeHeaders are never translated in either direction as they
+	// describe the connection rather than the request
+	unsafeHeaders = map[string]bool{
+		"connection":          true,
+		"content-length":      true,
+		"content-type":        true,
+		"host":                true,
+		"keep-alive":          true,
+		"proxy-connection":    true,
+		"proxy-authenticate":  true,
+		"proxy-authorization": true,
+		"te":                  true,
+		"trailer":             true,
+		"transfer-encoding":   true,
+		"upgrade":             true,
+	}
+)
+
+// GetHeadersAsMetadata converts request headers to grpc metadata
+// useful for passing auth headers, cookies to auth server.
+// Only DefaultForwardedHeaders are copied, with all their values.
+func GetHeadersAsMetadata(r *http.Request) metadata.MD {
+	return HeadersToMetadata(r.Header, DefaultForwardedHeaders...)
+}
+
+// HeadersToMetadata copies allowed headers to grpc metadata preserving
+// every value. Cookie header is reduced to ForwardedCookies.
+func HeadersToMetadata(headers http.Header, allowed ...string) metadata.MD {
+	md := metadata.MD{}
+	for _, name := range allowed {
+		key := strings.ToLower(name)
+		if unsafeHeaders[key] || isReservedMetadataKey(key) {
+			continue
+		}
+		values := headers.Values(name)
+		if key == "cookie" {
+			values = filterCookies(headers)
+		}
+		if len(values) > 0 {
+			md.Append(key, values...)
+		}
+	}
+	return md
+}
+
+// MetadataToHeaders converts grpc metadata to http headers, useful when
+// bridging a grpc call to a http endpoint protected by frontier.
+// Pseudo headers, grpc reserved keys, binary values and connection
+// specific headers are dropped.
+func MetadataToHeaders(md metadata.MD) http.Header {
+	headers := http.Header{}
+	for key, values := range md {
+		key = strings.ToLower(key)
+		if unsafeHeaders[key] || isReservedMetadataKey(key) || strings.HasSuffix(key, "-bin") {
+			continue
+		}
+		canonical := textproto.CanonicalMIMEHeaderKey(key)
+		for _, v := range values {
+			headers.Add(canonical, v)
+		}
+	}
+	return headers
+}
+
+func isReservedMetadataKey(key string) bool {
+	return strings.HasPrefix(key, ":") || strings.HasPrefix(key, "grpc-")
+}
+
+func filterCookies(headers http.Header) []string {
+	r := &http.Request{Header: headers}
+	var kept []string
+	for _, c := range r.Cookies() {
+		for _, name := range ForwardedCookies {
+			if c.Name == name {
+				kept = append(kept, c.String())
+			}
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return []string{strings.Join(kept, "; ")}
+}
@@ -0,0 +1,105 @@
+package client_test
+
+import (
+	"github.com/raystack/frontier-go/client"
+	"github.com/raystack/frontier-go/pkg"
+	"google.golang.org/grpc/metadata"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestHeadersToMetadata(t *testing.T) {
+	session := (&http.Cookie{Name: pkg.DefaultSessionID, Value: "s1"}).String()
+	tests := []struct {
+		name    string
+		headers http.Header
+		allowed []string
+		want    metadata.MD
+	}{
+		{
+			name:    "allow-listed headers with every value",
+			headers: http.Header{"Authorization": {"Bearer t"}, "Traceparent": {"00-a-b-01"}, "X-Request-Id": {"r1", "r2"}},
+			allowed: client.DefaultForwardedHeaders,
+			want:    metadata.MD{"authorization": {"Bearer t"}, "traceparent": {"00-a-b-01"}, "x-request-id": {"r1", "r2"}},
+		},
+		{
+			name:    "headers not allowed are dropped",
+			headers: http.Header{"Authorization": {"Bearer t"}, "X-Api-Key": {"secret"}},
+			allowed: []string{"Authorization"},
+			want:    metadata.MD{"authorization": {"Bearer t"}},
+		},
+		{
+			name:    "user token header",
+			headers: http.Header{http.CanonicalHeaderKey(pkg.DefaultUserTokenHeader): {"token"}},
+			allowed: client.DefaultForwardedHeaders,
+			want:    metadata.MD{pkg.DefaultUserTokenHeader: {"token"}},
+		},
+		{
+			name:    "only session cookie is kept",
+			headers: http.Header{"Cookie": {"theme=dark; " + session, "csrf=x"}},
+			allowed: client.DefaultForwardedHeaders,
+			want:    metadata.MD{"cookie": {session}},
+		},
+		{
+			name:    "cookie header without session is dropped",
+			headers: http.Header{"Cookie": {"theme=dark"}},
+			allowed: client.DefaultForwardedHeaders,
+			want:    metadata.MD{},
+		},
+		{
+			name:    "unsafe and reserved headers are never copied",
+			headers: http.Header{"Host": {"example.com"}, "Connection": {"close"}, "Grpc-Timeout": {"1S"}},
+			allowed: []string{"Host", "Connection", "Grpc-Timeout"},
+			want:    metadata.MD{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.HeadersToMetadata(tt.headers, tt.allowed...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("HeadersToMetadata() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetadataToHeaders(t *testing.T) {
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want http.Header
+	}{
+		{
+			name: "keys are canonicalized with every value",
+			md:   metadata.MD{"authorization": {"Bearer t"}, "x-request-id": {"r1", "r2"}},
+			want: http.Header{"Authorization": {"Bearer t"}, "X-Request-Id": {"r1", "r2"}},
+		},
+		{
+			name: "pseudo, reserved, binary and unsafe keys are dropped",
+			md: metadata.MD{":authority": {"frontier"}, "grpc-timeout": {"1S"}, "trace-bin": {"\x00"},
+				"content-type": {"application/grpc"}, "te": {"trailers"}, "cookie": {"sid=1"}},
+			want: http.Header{"Cookie": {"sid=1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := client.MetadataToHeaders(tt.md); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MetadataToHeaders() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeadersMetadataRoundTrip(t *testing.T) {
+	session := (&http.Cookie{Name: pkg.DefaultSessionID, Value: "s1"}).String()
+	headers := http.Header{
+		"Authorization": {"Bearer t"},
+		"Cookie":        {session},
+		"Traceparent":   {"00-a-b-01"},
+		"X-Request-Id":  {"r1", "r2"},
+	}
+	r := &http.Request{Header: headers}
+	if got := client.MetadataToHeaders(client.GetHeadersAsMetadata(r)); !reflect.DeepEqual(got, headers) {
+		t.Errorf("round trip = %v, want %v", got, headers)
+	}
+}
@@ -0,0 +1,231 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"google.golang.org/grpc/credentials"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidCACert     = errors.New("failed to append ca certificates to pool")
+	ErrMissingClientCert = errors.New("both client certificate and key are required")
+)
+
+// TLSOptions holds the configuration used to build transport credentials
+// for dialing frontier over TLS or mTLS
+type TLSOptions struct {
+	useSystemPool  bool
+	caFiles        []string
+	caPEMs         [][]byte
+	clientCertFile string
+	clientKeyFile  string
+	clientCert     *tls.Certificate
+	serverName     string
+	reloadInterval time.Duration
+	minVersion     uint16
+}
+
+// WithSystemCertPool trusts the host's root CAs in addition to any
+// custom CA configured. Enabled by default when no custom CA is provided.
+func WithSystemCertPool() func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.useSystemPool = true
+	}
+}
+
+// WithCACertFile adds PEM encoded CA certificates read from file to the trust pool
+func WithCACertFile(path string) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.caFiles = append(o.caFiles, path)
+	}
+}
+
+// WithCACertPEM adds PEM encoded CA certificates to the trust pool
+func WithCACertPEM(pem []byte) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.caPEMs = append(o.caPEMs, pem)
+	}
+}
+
+// WithClientCertFile configures a client certificate and key pair read
+// from PEM files, used when frontier requires mTLS
+func WithClientCertFile(certFile, keyFile string) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.clientCertFile = certFile
+		o.clientKeyFile = keyFile
+	}
+}
+
+// WithClientCertificate configures an already loaded client certificate
+func WithClientCertificate(cert tls.Certificate) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.clientCert = &cert
+	}
+}
+
+// WithServerName overrides the server name used to verify the certificate
+// returned by frontier, useful when dialing via an ip or internal alias
+func WithServerName(name string) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.serverName = name
+	}
+}
+
+// WithCertReloadInterval re-reads CA and client certificate files at most
+// once per interval so rotated certificates are picked up by new connections
+// without restarting the process. Only file based certificates are reloaded.
+func WithCertReloadInterval(interval time.Duration) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.reloadInterval = interval
+	}
+}
+
+// WithMinTLSVersion sets the minimum accepted TLS version, defaults to TLS 1.2
+func WithMinTLSVersion(version uint16) func(*TLSOptions) {
+	return func(o *TLSOptions) {
+		o.minVersion = version
+	}
+}
+
+// NewTLSConfig builds a tls.Config from options
+func NewTLSConfig(opts ...func(*TLSOptions)) (*tls.Config, error) {
+	o := newTLSOptions(opts...)
+	return o.build()
+}
+
+// NewTLSCredentials builds grpc transport credentials from options.
+// If a reload interval is configured, certificate files are re-read
+// during handshakes once the interval has elapsed.
+func NewTLSCredentials(opts ...func(*TLSOptions)) (credentials.TransportCredentials, error) {
+	o := newTLSOptions(opts...)
+	cfg, err := o.build()
+	if err != nil {
+		return nil, err
+	}
+	if o.reloadInterval <= 0 {
+		return credentials.NewTLS(cfg), nil
+	}
+	return &reloadingCredentials{
+		opts:     o,
+		creds:    credentials.NewTLS(cfg),
+		loadedAt: time.Now(),
+	}, nil
+}
+
+func newTLSOptions(opts ...func(*TLSOptions)) *TLSOptions {
+	o := &TLSOptions{
+		minVersion: tls.VersionTLS12,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *TLSOptions) build() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: o.minVersion,
+		ServerName: o.serverName,
+	}
+
+	// leaving RootCAs nil makes crypto/tls use the system pool
+	if len(o.caFiles) > 0 || len(o.caPEMs) > 0 {
+		pool := x509.NewCertPool()
+		if o.useSystemPool {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return nil, fmt.Errorf("failed to load system cert pool: %w", err)
+			}
+			pool = systemPool
+		}
+		for _, caFile := range o.caFiles {
+			pem, err := os.ReadFile(caFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read ca certificate %s: %w", caFile, err)
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidCACert, caFile)
+			}
+		}
+		for _, pem := range o.caPEMs {
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, ErrInvalidCACert
+			}
+		}
+		cfg.RootCAs = pool
+	}
+
+	if (o.clientCertFile == "") != (o.clientKeyFile == "") {
+		return nil, ErrMissingClientCert
+	}
+	if o.clientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.clientCertFile, o.clientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	} else if o.clientCert != nil {
+		cfg.Certificates = []tls.Certificate{*o.clientCert}
+	}
+	return cfg, nil
+}
+
+// reloadingCredentials rebuilds the underlying tls credentials from
+// files when the reload interval has passed. Failing reloads keep
+// serving the last good configuration.
+type reloadingCredentials struct {
+	opts *TLSOptions
+
+	mu       sync.Mutex
+	creds    credentials.TransportCredentials
+	loadedAt time.Time
+}
+
+func (c *reloadingCredentials) current() credentials.TransportCredentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if time.Since(c.loadedAt) >= c.opts.reloadInterval {
+		c.loadedAt = time.Now()
+		if cfg, err := c.opts.build(); err == nil {
+			c.creds = credentials.NewTLS(cfg)
+		}
+	}
+	return c.creds
+}
+
+func (c *reloadingCredentials) ClientHandshake(ctx context.Context, authority string, rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ClientHandshake(ctx, authority, rawConn)
+}
+
+func (c *reloadingCredentials) ServerHandshake(rawConn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return c.current().ServerHandshake(rawConn)
+}
+
+func (c *reloadingCredentials) Info() credentials.ProtocolInfo {
+	return c.current().Info()
+}
+
+func (c *reloadingCredentials) Clone() credentials.TransportCredentials {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	opts := *c.opts
+	return &reloadingCredentials{
+		opts:     &opts,
+		creds:    c.creds.Clone(),
+		loadedAt: c.loadedAt,
+	}
+}
+
+func (c *reloadingCredentials) OverrideServerName(serverNameOverride string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.opts.serverName = serverNameOverride
+	return c.creds.OverrideServerName(serverNameOverride) //nolint:staticcheck
+}
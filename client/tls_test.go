@@ -0,0 +1,241 @@
+package client_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"github.com/raystack/frontier-go/client"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM encoded certificate and key for localhost
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newTLSServer serves an unimplemented frontier over TLS, verifying
+// client certificates against clientCA if not nil
+func newTLSServer(t *testing.T, ca *testCA, clientCA *testCA) string {
+	t.Helper()
+	certPEM, keyPEM := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if clientCA != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(clientCA.cert)
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer(grpc.Creds(credentials.NewTLS(cfg)))
+	frontierv1beta1.RegisterFrontierServiceServer(srv, frontierv1beta1.UnimplementedFrontierServiceServer{})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// callFrontier reaches the server through conn, unimplemented means the
+// call made it through TLS
+func callFrontier(conn *client.Conn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	_, err := conn.Frontier.GetCurrentUser(ctx, &frontierv1beta1.GetCurrentUserRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	return err
+}
+
+func TestDialConfigTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, clientCA, otherCA := newTestCA(t), newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.pem)
+	otherCAFile := filepath.Join(dir, "other-ca.pem")
+	writeFile(t, otherCAFile, otherCA.pem)
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	certPEM, keyPEM := clientCA.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+	untrustedCertFile, untrustedKeyFile := filepath.Join(dir, "untrusted.crt"), filepath.Join(dir, "untrusted.key")
+	certPEM, keyPEM = otherCA.issue(t, x509.ExtKeyUsageClientAuth)
+	writeFile(t, untrustedCertFile, certPEM)
+	writeFile(t, untrustedKeyFile, keyPEM)
+
+	tlsEndpoint := newTLSServer(t, ca, nil)
+	mTLSEndpoint := newTLSServer(t, ca, clientCA)
+
+	tests := []struct {
+		name    string
+		cfg     pkg.Config
+		wantErr bool
+	}{
+		{name: "tls", cfg: pkg.Config{GRPCEndpoint: tlsEndpoint, CACertFile: caFile}},
+		{name: "tls with untrusted server", cfg: pkg.Config{GRPCEndpoint: tlsEndpoint, CACertFile: otherCAFile}, wantErr: true},
+		{name: "mtls", cfg: pkg.Config{GRPCEndpoint: mTLSEndpoint, CACertFile: caFile, CertFile: certFile, KeyFile: keyFile}},
+		{name: "mtls with reload", cfg: pkg.Config{GRPCEndpoint: mTLSEndpoint, CACertFile: caFile, CertFile: certFile, KeyFile: keyFile,
+			CertReloadInterval: time.Minute}},
+		{name: "mtls without client certificate", cfg: pkg.Config{GRPCEndpoint: mTLSEndpoint, CACertFile: caFile}, wantErr: true},
+		{name: "mtls with untrusted client certificate", cfg: pkg.Config{GRPCEndpoint: mTLSEndpoint, CACertFile: caFile,
+			CertFile: untrustedCertFile, KeyFile: untrustedKeyFile}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.DialTimeout = time.Second
+			conn, err := client.DialConfig(context.Background(), tt.cfg)
+			if err == nil {
+				err = callFrontier(conn)
+				conn.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DialConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDialConfigRequiresCertAndKey(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	writeFile(t, certFile, nil)
+	_, err := client.DialConfig(context.Background(), pkg.Config{GRPCEndpoint: "localhost:7401", CertFile: certFile})
+	if !errors.Is(err, pkg.ErrInvalidConfig) {
+		t.Errorf("DialConfig() with cert_file but no key_file error = %v, want ErrInvalidConfig", err)
+	}
+}
+
+func TestTLSCredentialsReload(t *testing.T) {
+	dir := t.TempDir()
+	oldCA, newCA := newTestCA(t), newTestCA(t)
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, oldCA.pem)
+	// server certificate is already issued by the ca the client is yet to trust
+	endpoint := newTLSServer(t, newCA, nil)
+
+	const interval = 200 * time.Millisecond
+	creds, err := client.NewTLSCredentials(client.WithCACertFile(caFile), client.WithCertReloadInterval(interval))
+	if err != nil {
+		t.Fatalf("NewTLSCredentials() error = %v", err)
+	}
+	handshake := func() error {
+		t.Helper()
+		rawConn, err := net.Dial("tcp", endpoint)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer rawConn.Close()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		conn, _, err := creds.ClientHandshake(ctx, "localhost", rawConn)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	if err := handshake(); err == nil {
+		t.Fatal("handshake trusting old ca succeeded")
+	}
+	writeFile(t, caFile, newCA.pem)
+	if err := handshake(); err == nil {
+		t.Error("handshake before reload interval picked up new ca")
+	}
+	time.Sleep(interval)
+	if err := handshake(); err != nil {
+		t.Fatalf("handshake after reload error = %v", err)
+	}
+
+	// a broken file keeps the last good certificates
+	writeFile(t, caFile, []byte("not a certificate"))
+	time.Sleep(interval)
+	if err := handshake(); err != nil {
+		t.Errorf("handshake after failed reload error = %v", err)
+	}
+}
@@ -9,11 +9,11 @@ Ensure serviceuser has a role assinged in org for viewer.[/v1beta1/policies]
 package main
 
 import (
+	"context"
 	_ "embed"
 	"fmt"
 	"github.com/raystack/frontier-go/pkg"
-	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
-	"google.golang.org/protobuf/encoding/protojson"
+	"golang.org/x/oauth2"
 	"io"
 	"net/http"
 )
@@ -26,26 +26,18 @@ var (
 )
 
 func main() {
-	credential := &frontierv1beta1.KeyCredential{}
-	if err := protojson.Unmarshal(serviceUserKey, credential); err != nil {
-		panic(err)
-	}
-	tokenGenerator, err := pkg.GetServiceUserTokenGenerator(credential)
-	if err != nil {
-		panic(err)
-	}
-	tempToken, err := tokenGenerator()
+	credential, err := pkg.LoadKeyCredential(serviceUserKey)
 	if err != nil {
 		panic(err)
 	}
-
-	protectedServerRequest, err := http.NewRequest(http.MethodGet, serverAddr+"/ping?org_id=org1", nil)
+	// tokens are minted on demand and reused until close to expiry
+	tokenSource, err := pkg.NewServiceUserTokenSource(credential)
 	if err != nil {
 		panic(err)
 	}
-	protectedServerRequest.Header.Set("Authorization", fmt.Sprintf("Bearer %s", tempToken))
+	httpClient := oauth2.NewClient(context.Background(), tokenSource)
 
-	resp, err := http.DefaultClient.Do(protectedServerRequest)
+	resp, err := httpClient.Get(serverAddr + "/ping?org_id=org1")
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,189 @@
+package frontiertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/raystack/frontier-go/client"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/encoding/protojson"
+	"net"
+	"net/http"
+)
+
+const bufSize = 1 << 20
+
+// grpcServer serves the fake over an in-memory listener
+type grpcServer struct {
+	frontierv1beta1.UnimplementedFrontierServiceServer
+
+	fake     *Server
+	listener *bufconn.Listener
+	server   *grpc.Server
+}
+
+func newGRPCServer(fake *Server) *grpcServer {
+	g := &grpcServer{
+		fake:     fake,
+		listener: bufconn.Listen(bufSize),
+		server:   grpc.NewServer(),
+	}
+	frontierv1beta1.RegisterFrontierServiceServer(g.server, g)
+	healthpb.RegisterHealthServer(g.server, health.NewServer())
+	go func() {
+		_ = g.server.Serve(g.listener)
+	}()
+	return g
+}
+
+func (g *grpcServer) close() {
+	g.server.Stop()
+	_ = g.listener.Close()
+}
+
+// DialOpts returns grpc dial options connecting to the in-memory grpc server
+func (s *Server) DialOpts() []grpc.DialOption {
+	return append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return s.grpc.listener.DialContext(ctx)
+		}),
+	}, client.InsecureDialOpts...)
+}
+
+// Dial connects a client to the in-memory grpc server
+func (s *Server) Dial(ctx context.Context) (*client.Conn, error) {
+	return client.Dial(ctx, "passthrough:///frontiertest", s.DialOpts()...)
+}
+
+func (g *grpcServer) GetCurrentUser(ctx context.Context, _ *frontierv1beta1.GetCurrentUserRequest) (*frontierv1beta1.GetCurrentUserResponse, error) {
+	principalID, err := g.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	g.fake.mu.RLock()
+	user, ok := g.fake.users[principalID]
+	serviceUser, isServiceUser := g.fake.serviceUsers[principalID]
+	g.fake.mu.RUnlock()
+	if isServiceUser {
+		return &frontierv1beta1.GetCurrentUserResponse{Serviceuser: serviceUser}, nil
+	}
+	if !ok {
+		return nil, status.Error(codes.NotFound, ErrUnknownPrincipal.Error())
+	}
+	return &frontierv1beta1.GetCurrentUserResponse{User: user}, nil
+}
+
+func (g *grpcServer) CheckResourcePermission(ctx context.Context, req *frontierv1beta1.CheckResourcePermissionRequest) (*frontierv1beta1.CheckResourcePermissionResponse, error) {
+	principalID, err := g.principal(ctx)
+	if err != nil {
+		return nil, err
+	}
+	allowed := g.fake.check(principalID, checkResource(req), req.GetPermission())
+	return &frontierv1beta1.CheckResourcePermissionResponse{Status: allowed}, nil
+}
+
+func (g *grpcServer) GetJWKs(context.Context, *frontierv1beta1.GetJWKsRequest) (*frontierv1beta1.GetJWKsResponse, error) {
+	keys, err := toProtoKeys(g.fake.PublicKeys())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &frontierv1beta1.GetJWKsResponse{Keys: keys}, nil
+}
+
+func (g *grpcServer) GetServiceUserKey(_ context.Context, req *frontierv1beta1.GetServiceUserKeyRequest) (*frontierv1beta1.GetServiceUserKeyResponse, error) {
+	keySet, err := g.fake.serviceUserKeySet(req.GetId(), req.GetKeyId())
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	keys, err := toProtoKeys(keySet)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &frontierv1beta1.GetServiceUserKeyResponse{Keys: keys}, nil
+}
+
+func (g *grpcServer) AuthToken(ctx context.Context, req *frontierv1beta1.AuthTokenRequest) (*frontierv1beta1.AuthTokenResponse, error) {
+	resp, err := g.fake.authToken(ctx, req)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return resp, nil
+}
+
+func (g *grpcServer) CreateServiceUserKey(ctx context.Context, req *frontierv1beta1.CreateServiceUserKeyRequest) (*frontierv1beta1.CreateServiceUserKeyResponse, error) {
+	if err := g.managesKeys(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	credential, err := g.fake.CreateServiceUserKey(req.GetId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &frontierv1beta1.CreateServiceUserKeyResponse{Key: credential}, nil
+}
+
+func (g *grpcServer) DeleteServiceUserKey(ctx context.Context, req *frontierv1beta1.DeleteServiceUserKeyRequest) (*frontierv1beta1.DeleteServiceUserKeyResponse, error) {
+	if err := g.managesKeys(ctx, req.GetId()); err != nil {
+		return nil, err
+	}
+	g.fake.DeleteServiceUserKey(req.GetId(), req.GetKeyId())
+	return &frontierv1beta1.DeleteServiceUserKeyResponse{}, nil
+}
+
+// managesKeys checks the caller is the service user, which may manage its keys
+func (g *grpcServer) managesKeys(ctx context.Context, serviceUserID string) error {
+	principalID, err := g.principal(ctx)
+	if err != nil {
+		return err
+	}
+	if principalID != serviceUserID {
+		return status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+	}
+	return nil
+}
+
+func (g *grpcServer) principal(ctx context.Context) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	var sessionID string
+	if cookies := md.Get("cookie"); len(cookies) > 0 {
+		r := &http.Request{Header: http.Header{"Cookie": cookies}}
+		if cookie, err := r.Cookie(pkg.DefaultSessionID); err == nil {
+			sessionID = cookie.Value
+		}
+	}
+	principalID, err := g.fake.principal(ctx, first("authorization"), first(pkg.DefaultUserTokenHeader), sessionID)
+	if err != nil {
+		if errors.Is(err, ErrUnknownPrincipal) || errors.Is(err, ErrUnauthenticated) {
+			return "", status.Error(codes.Unauthenticated, err.Error())
+		}
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	return principalID, nil
+}
+
+func toProtoKeys(set jwk.Set) ([]*frontierv1beta1.JSONWebKey, error) {
+	raw, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	resp := &frontierv1beta1.GetJWKsResponse{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, resp); err != nil {
+		return nil, err
+	}
+	return resp.GetKeys(), nil
+}
@@ -0,0 +1,165 @@
+package frontiertest
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// pendingLogin is a login started at /v1beta1/auth/register and not yet
+// completed at callback
+type pendingLogin struct {
+	strategy string
+	userID   string
+	code     string
+}
+
+// EnableLoginStrategy enables login with strategy, e.g. google. Logins
+// with it succeed as the registered user userID without a provider: the
+// endpoint returned at start points straight to callback url with state
+// and code set.
+func (s *Server) EnableLoginStrategy(strategy, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPrincipal, userID)
+	}
+	s.loginStrategies[strategy] = userID
+	return nil
+}
+
+// SessionUser returns the user logged in with sessionID, if the session
+// exists
+func (s *Server) SessionUser(sessionID string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	userID, ok := s.sessions[sessionID]
+	return userID, ok
+}
+
+func (s *Server) handleAuthStrategies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s.mu.RLock()
+	resp := &frontierv1beta1.ListAuthStrategiesResponse{}
+	for name := range s.loginStrategies {
+		resp.Strategies = append(resp.Strategies, &frontierv1beta1.AuthStrategy{Name: name})
+	}
+	s.mu.RUnlock()
+	sort.Slice(resp.Strategies, func(i, j int) bool {
+		return resp.Strategies[i].GetName() < resp.Strategies[j].GetName()
+	})
+	writeProto(w, http.StatusOK, resp)
+}
+
+// handleAuthStart starts a login at /v1beta1/auth/register/:strategy
+func (s *Server) handleAuthStart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	req := &frontierv1beta1.AuthenticateRequest{}
+	if r.Method == http.MethodPost {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := protojson.Unmarshal(body, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	req.StrategyName = strings.TrimPrefix(r.URL.Path, strings.TrimSuffix(pkg.AuthStartPath, "%s"))
+	callback, err := url.Parse(req.GetCallbackUrl())
+	if err != nil || !callback.IsAbs() {
+		http.Error(w, "invalid callback url", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	userID, ok := s.loginStrategies[req.GetStrategyName()]
+	login := pendingLogin{strategy: req.GetStrategyName(), userID: userID, code: uuid.New().String()}
+	state := uuid.New().String()
+	if ok {
+		s.pendingLogins[state] = login
+	}
+	s.mu.Unlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown login strategy %q", req.GetStrategyName()), http.StatusBadRequest)
+		return
+	}
+
+	query := callback.Query()
+	query.Set("state", state)
+	query.Set("code", login.code)
+	callback.RawQuery = query.Encode()
+	writeProto(w, http.StatusOK, &frontierv1beta1.AuthenticateResponse{Endpoint: callback.String(), State: state})
+}
+
+// handleAuthCallback completes a pending login and sets the session cookie
+func (s *Server) handleAuthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &frontierv1beta1.AuthCallbackRequest{}
+	if err := protojson.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	login, ok := s.pendingLogins[req.GetState()]
+	if ok {
+		// states are single use, failed attempts included
+		delete(s.pendingLogins, req.GetState())
+	}
+	valid := ok && login.code == req.GetCode() &&
+		(req.GetStrategyName() == "" || req.GetStrategyName() == login.strategy)
+	sessionID := uuid.New().String()
+	if valid {
+		s.sessions[sessionID] = login.userID
+	}
+	s.mu.Unlock()
+	if !valid {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: pkg.DefaultSessionID, Value: sessionID, Path: "/", HttpOnly: true})
+	writeProto(w, http.StatusOK, &frontierv1beta1.AuthCallbackResponse{})
+}
+
+// handleAuthLogout deletes the session of the request cookie
+func (s *Server) handleAuthLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	cookie, err := r.Cookie(pkg.DefaultSessionID)
+	if err != nil {
+		http.Error(w, ErrUnauthenticated.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	delete(s.sessions, cookie.Value)
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: pkg.DefaultSessionID, Value: "", Path: "/", MaxAge: -1})
+	writeProto(w, http.StatusOK, &frontierv1beta1.AuthLogoutResponse{})
+}
@@ -0,0 +1,682 @@
+// Package frontiertest provides an in-process fake of frontier for tests.
+//
+// The fake serves the REST endpoints used by the sdk over httptest and the
+// same operations over an in-memory grpc connection. Users, service users
+// and permission tuples are declared upfront; checks are answered from them.
+//
+//	srv := frontiertest.NewServer()
+//	defer srv.Close()
+//	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1", Email: "user@raystack.org"})
+//	srv.Allow("user-1", "project:1", "update")
+//	token, _ := srv.MintUserToken("user-1")
+//	authHandler, _ := middleware.NewAuthHandler(middleware.WithRESTEndpoint(srv.RESTEndpoint()))
+package frontiertest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/raystack/frontier-go/pkg"
+	"github.com/raystack/frontier/pkg/utils"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Issuer is set as issuer of user tokens minted by the fake
+	Issuer = "frontiertest"
+
+	DefaultTokenValidity = time.Hour
+)
+
+var (
+	ErrUnknownPrincipal = errors.New("frontiertest: unknown principal")
+	ErrUnauthenticated  = errors.New("frontiertest: request is not authenticated")
+	ErrPermissionDenied = errors.New("frontiertest: permission denied")
+)
+
+// Tuple grants principal a permission on resource
+type Tuple struct {
+	PrincipalID string
+	Resource    string
+	Permission  string
+}
+
+// CheckRecord is a check served by the fake
+type CheckRecord struct {
+	Tuple
+	Allowed bool
+}
+
+type serviceUserSecret struct {
+	serviceUserID string
+	secret        string
+}
+
+// Server is a fake frontier, create one with NewServer
+type Server struct {
+	// HTTP serves the REST api, Close it through Server.Close
+	HTTP *httptest.Server
+
+	mu              sync.RWMutex
+	signingKey      jwk.Key
+	publicKeys      jwk.Set
+	users           map[string]*frontierv1beta1.User
+	sessions        map[string]string
+	serviceUsers    map[string]*frontierv1beta1.ServiceUser
+	serviceUserKeys map[string]map[string]jwk.Key
+	// serviceUserSecrets maps client id of a secret to its service user
+	serviceUserSecrets map[string]serviceUserSecret
+	// loginStrategies maps enabled login strategies to the user they log in
+	loginStrategies map[string]string
+	pendingLogins   map[string]pendingLogin
+	tuples          map[Tuple]bool
+	checks          []CheckRecord
+
+	grpc *grpcServer
+}
+
+// NewServer starts a fake frontier. It panics if keys can't be generated
+// or a listener can't be created, similar to httptest.NewServer.
+func NewServer() *Server {
+	signingKey, publicKey, err := newSigningKey()
+	if err != nil {
+		panic(fmt.Sprintf("frontiertest: %v", err))
+	}
+	publicKeys := jwk.NewSet()
+	if err := publicKeys.AddKey(publicKey); err != nil {
+		panic(fmt.Sprintf("frontiertest: failed to build jwks: %v", err))
+	}
+
+	s := &Server{
+		signingKey:         signingKey,
+		publicKeys:         publicKeys,
+		users:              map[string]*frontierv1beta1.User{},
+		sessions:           map[string]string{},
+		serviceUsers:       map[string]*frontierv1beta1.ServiceUser{},
+		serviceUserKeys:    map[string]map[string]jwk.Key{},
+		serviceUserSecrets: map[string]serviceUserSecret{},
+		loginStrategies:    map[string]string{},
+		pendingLogins:      map[string]pendingLogin{},
+		tuples:             map[Tuple]bool{},
+	}
+	s.HTTP = httptest.NewServer(s.routes())
+	s.grpc = newGRPCServer(s)
+	return s
+}
+
+// Close shuts down http and grpc servers
+func (s *Server) Close() {
+	s.HTTP.Close()
+	s.grpc.close()
+}
+
+// RESTEndpoint returns url of the fake to be used as frontier host
+func (s *Server) RESTEndpoint() *url.URL {
+	u, _ := url.Parse(s.HTTP.URL)
+	return u
+}
+
+// PublicKeys returns the jwks used to verify user tokens minted by the fake
+func (s *Server) PublicKeys() jwk.Set {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.publicKeys
+}
+
+// RotateSigningKey switches to a new signing key for user tokens, as frontier
+// does on key rotation. The previous public key is kept in the jwks only if
+// keepPrevious is set, so tokens minted earlier keep verifying.
+func (s *Server) RotateSigningKey(keepPrevious bool) (string, error) {
+	signingKey, publicKey, err := newSigningKey()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	publicKeys := jwk.NewSet()
+	if keepPrevious {
+		for i := 0; i < s.publicKeys.Len(); i++ {
+			key, _ := s.publicKeys.Key(i)
+			if err := publicKeys.AddKey(key); err != nil {
+				return "", err
+			}
+		}
+	}
+	if err := publicKeys.AddKey(publicKey); err != nil {
+		return "", err
+	}
+	s.signingKey, s.publicKeys = signingKey, publicKeys
+	return signingKey.KeyID(), nil
+}
+
+// RegisterUser adds user, an id is generated if missing
+func (s *Server) RegisterUser(user *frontierv1beta1.User) *frontierv1beta1.User {
+	user = proto.Clone(user).(*frontierv1beta1.User)
+	if user.GetId() == "" {
+		user.Id = uuid.New().String()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[user.GetId()] = user
+	return user
+}
+
+// MintUserToken creates a frontier issued access token for a registered user
+func (s *Server) MintUserToken(userID string) (string, error) {
+	s.mu.RLock()
+	user, ok := s.users[userID]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownPrincipal, userID)
+	}
+	return s.mintAccessToken(user.GetId(), map[string]string{
+		"email": user.GetEmail(),
+		"name":  user.GetName(),
+	})
+}
+
+// MintServiceUserAccessToken creates a frontier issued access token for a
+// registered service user, as returned by the auth token endpoint
+func (s *Server) MintServiceUserAccessToken(serviceUserID string) (string, error) {
+	s.mu.RLock()
+	_, ok := s.serviceUsers[serviceUserID]
+	s.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownPrincipal, serviceUserID)
+	}
+	return s.mintAccessToken(serviceUserID, nil)
+}
+
+func (s *Server) mintAccessToken(principalID string, claims map[string]string) (string, error) {
+	s.mu.RLock()
+	signingKey := s.signingKey
+	s.mu.RUnlock()
+	systemClaims := map[string]string{"gen": "system"}
+	for k, v := range claims {
+		systemClaims[k] = v
+	}
+	token, err := utils.BuildToken(signingKey, Issuer, principalID, DefaultTokenValidity, systemClaims)
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// CreateSession returns a session cookie for a registered user, as set
+// by frontier after a browser login
+func (s *Server) CreateSession(userID string) (*http.Cookie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[userID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrincipal, userID)
+	}
+	sessionID := uuid.New().String()
+	s.sessions[sessionID] = userID
+	return &http.Cookie{Name: pkg.DefaultSessionID, Value: sessionID, Path: "/"}, nil
+}
+
+// RegisterServiceUser adds a service user with a new key pair and returns
+// the key credential as frontier does on /v1beta1/serviceusers/:id/keys
+func (s *Server) RegisterServiceUser(id string) (*frontierv1beta1.KeyCredential, error) {
+	if id == "" {
+		id = uuid.New().String()
+	}
+	s.mu.Lock()
+	if _, ok := s.serviceUsers[id]; !ok {
+		s.serviceUsers[id] = &frontierv1beta1.ServiceUser{Id: id, Title: id}
+	}
+	s.mu.Unlock()
+	return s.CreateServiceUserKey(id)
+}
+
+// CreateServiceUserKey adds a new RSA key pair to an existing service user
+func (s *Server) CreateServiceUserKey(serviceUserID string) (*frontierv1beta1.KeyCredential, error) {
+	return s.CreateServiceUserKeyWithAlgorithm(serviceUserID, jwa.RS256)
+}
+
+// CreateServiceUserKeyWithAlgorithm adds a new key pair for signing with alg
+// to an existing service user, one of RS256, ES256, ES384, ES512 or EdDSA.
+// Public keys of non RSA pairs don't declare their alg.
+func (s *Server) CreateServiceUserKeyWithAlgorithm(serviceUserID string, alg jwa.SignatureAlgorithm) (*frontierv1beta1.KeyCredential, error) {
+	keyID := uuid.New().String()
+	privateKey, keyType, err := newServiceUserKey(keyID, alg)
+	if err != nil {
+		return nil, err
+	}
+	privatePEM, err := jwk.Pem(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := privateKey.PublicKey()
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.serviceUsers[serviceUserID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrincipal, serviceUserID)
+	}
+	if s.serviceUserKeys[serviceUserID] == nil {
+		s.serviceUserKeys[serviceUserID] = map[string]jwk.Key{}
+	}
+	s.serviceUserKeys[serviceUserID][keyID] = publicKey
+	return &frontierv1beta1.KeyCredential{
+		Type:        keyType,
+		Kid:         keyID,
+		PrincipalId: serviceUserID,
+		PrivateKey:  string(privatePEM),
+	}, nil
+}
+
+// CreateServiceUserSecret adds a client secret to an existing service user,
+// its id and secret are accepted by the client credentials grant
+func (s *Server) CreateServiceUserSecret(serviceUserID string) (*frontierv1beta1.SecretCredential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.serviceUsers[serviceUserID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPrincipal, serviceUserID)
+	}
+	credential := &frontierv1beta1.SecretCredential{
+		Id:        uuid.New().String(),
+		Title:     "frontiertest",
+		Secret:    uuid.New().String(),
+		CreatedAt: timestamppb.Now(),
+	}
+	s.serviceUserSecrets[credential.GetId()] = serviceUserSecret{serviceUserID: serviceUserID, secret: credential.GetSecret()}
+	return credential, nil
+}
+
+// DeleteServiceUserKey removes a key, tokens signed with it stop verifying
+func (s *Server) DeleteServiceUserKey(serviceUserID, keyID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.serviceUserKeys[serviceUserID], keyID)
+}
+
+// MintServiceUserToken signs a token with service user key credential
+func (s *Server) MintServiceUserToken(credential *frontierv1beta1.KeyCredential) (string, error) {
+	generator, err := pkg.GetServiceUserTokenGenerator(credential)
+	if err != nil {
+		return "", err
+	}
+	token, err := generator()
+	if err != nil {
+		return "", err
+	}
+	return string(token), nil
+}
+
+// Allow grants principal permission on resource, resource is in the
+// form of "namespace:id"
+func (s *Server) Allow(principalID, resource, permission string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tuples[Tuple{PrincipalID: principalID, Resource: resource, Permission: permission}] = true
+}
+
+// Revoke removes a permission granted with Allow
+func (s *Server) Revoke(principalID, resource, permission string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.tuples, Tuple{PrincipalID: principalID, Resource: resource, Permission: permission})
+}
+
+// Checks returns all checks served so far in order
+func (s *Server) Checks() []CheckRecord {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]CheckRecord(nil), s.checks...)
+}
+
+func (s *Server) check(principalID, resource, permission string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tuple := Tuple{PrincipalID: principalID, Resource: resource, Permission: permission}
+	allowed := s.tuples[tuple]
+	s.checks = append(s.checks, CheckRecord{Tuple: tuple, Allowed: allowed})
+	return allowed
+}
+
+// principal resolves the caller from bearer token, user token header
+// or session cookie, the same way frontier does
+func (s *Server) principal(ctx context.Context, authorization, userToken, sessionID string) (string, error) {
+	token := strings.TrimSpace(userToken)
+	if strings.HasPrefix(authorization, "Bearer ") {
+		token = strings.TrimPrefix(authorization, "Bearer ")
+	}
+	if strings.HasPrefix(authorization, "Basic ") {
+		r := &http.Request{Header: http.Header{"Authorization": {authorization}}}
+		clientID, secret, _ := r.BasicAuth()
+		return s.secretPrincipal(clientID, secret)
+	}
+	if token != "" {
+		return s.verifyToken(ctx, token)
+	}
+	if sessionID != "" {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		if userID, ok := s.sessions[sessionID]; ok {
+			return userID, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+// secretPrincipal resolves the service user of a client secret
+func (s *Server) secretPrincipal(clientID, secret string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	stored, ok := s.serviceUserSecrets[clientID]
+	if !ok || subtle.ConstantTimeCompare([]byte(stored.secret), []byte(secret)) != 1 {
+		return "", fmt.Errorf("%w: invalid client credentials", ErrUnauthenticated)
+	}
+	return stored.serviceUserID, nil
+}
+
+func (s *Server) verifyToken(ctx context.Context, token string) (string, error) {
+	insecureToken, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	keySet := s.PublicKeys()
+	if gen, ok := insecureToken.Get("gen"); !ok || gen != "system" {
+		kid, _ := insecureToken.Get(jwk.KeyIDKey)
+		keySet, err = s.serviceUserKeySet(insecureToken.Subject(), fmt.Sprint(kid))
+		if err != nil {
+			return "", err
+		}
+	}
+	verified, err := jwt.Parse([]byte(token), jwt.WithKeySet(keySet, jws.WithInferAlgorithmFromKey(true)), jwt.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	return verified.Subject(), nil
+}
+
+func (s *Server) serviceUserKeySet(serviceUserID, keyID string) (jwk.Set, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.serviceUserKeys[serviceUserID][keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: key %s of %s", ErrUnknownPrincipal, keyID, serviceUserID)
+	}
+	set := jwk.NewSet()
+	if err := set.AddKey(key); err != nil {
+		return nil, err
+	}
+	return set, nil
+}
+
+func newSigningKey() (jwk.Key, jwk.Key, error) {
+	signingKey, err := utils.CreateJWKWithKID(uuid.New().String())
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create signing key: %w", err)
+	}
+	publicKey, err := signingKey.PublicKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive public key: %w", err)
+	}
+	return signingKey, publicKey, nil
+}
+
+// newServiceUserKey generates a private key for alg along with the type of
+// credential holding it
+func newServiceUserKey(keyID string, alg jwa.SignatureAlgorithm) (jwk.Key, string, error) {
+	var (
+		raw     any
+		err     error
+		keyType = pkg.KeyCredentialTypeECDSA
+	)
+	switch alg {
+	case jwa.RS256:
+		key, err := utils.CreateJWKWithKID(keyID)
+		return key, pkg.KeyCredentialTypeRSA, err
+	case jwa.ES256:
+		raw, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.ES384:
+		raw, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwa.ES512:
+		raw, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jwa.EdDSA:
+		_, raw, err = ed25519.GenerateKey(rand.Reader)
+		keyType = pkg.KeyCredentialTypeEd25519
+	default:
+		return nil, "", fmt.Errorf("frontiertest: unsupported key algorithm %s", alg)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	key, err := jwk.FromRaw(raw)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := key.Set(jwk.KeyIDKey, keyID); err != nil {
+		return nil, "", err
+	}
+	return key, keyType, nil
+}
+
+func (s *Server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pkg.JWKSAccessPath, s.handleJWKS)
+	mux.HandleFunc(pkg.CurrentUserProfilePath, s.handleCurrentUser)
+	mux.HandleFunc(pkg.CheckAccessPath, s.handleCheck)
+	mux.HandleFunc("/v1beta1/serviceusers/", s.handleServiceUserKey)
+	mux.HandleFunc(pkg.AuthTokenPath, s.handleAuthToken)
+	mux.HandleFunc(pkg.AuthStrategiesPath, s.handleAuthStrategies)
+	mux.HandleFunc(strings.TrimSuffix(pkg.AuthStartPath, "%s"), s.handleAuthStart)
+	mux.HandleFunc(pkg.AuthCallbackPath, s.handleAuthCallback)
+	mux.HandleFunc(pkg.AuthLogoutPath, s.handleAuthLogout)
+	return mux
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.PublicKeys())
+}
+
+func (s *Server) handleCurrentUser(w http.ResponseWriter, r *http.Request) {
+	principalID, err := s.httpPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	s.mu.RLock()
+	user, ok := s.users[principalID]
+	serviceUser, isServiceUser := s.serviceUsers[principalID]
+	s.mu.RUnlock()
+	if isServiceUser {
+		writeProto(w, http.StatusOK, &frontierv1beta1.GetCurrentUserResponse{Serviceuser: serviceUser})
+		return
+	}
+	if !ok {
+		http.Error(w, ErrUnknownPrincipal.Error(), http.StatusNotFound)
+		return
+	}
+	token, err := s.MintUserToken(principalID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set(pkg.DefaultUserTokenHeader, token)
+	writeProto(w, http.StatusOK, &frontierv1beta1.GetCurrentUserResponse{User: user})
+}
+
+func (s *Server) handleCheck(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	principalID, err := s.httpPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &frontierv1beta1.CheckResourcePermissionRequest{}
+	if err := protojson.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	allowed := s.check(principalID, checkResource(req), req.GetPermission())
+	writeProto(w, http.StatusOK, &frontierv1beta1.CheckResourcePermissionResponse{Status: allowed})
+}
+
+// handleServiceUserKey serves /v1beta1/serviceusers/:id/keys to create a
+// key and /v1beta1/serviceusers/:id/keys/:key_id to get or delete one.
+// Service users can only manage their own keys.
+func (s *Server) handleServiceUserKey(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 4 || len(parts) > 5 || parts[3] != "keys" {
+		http.NotFound(w, r)
+		return
+	}
+	serviceUserID := parts[2]
+	switch {
+	case len(parts) == 5 && r.Method == http.MethodGet:
+		keySet, err := s.serviceUserKeySet(serviceUserID, parts[4])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, keySet)
+	case len(parts) == 4 && r.Method == http.MethodPost:
+		if !s.httpManagesKeys(w, r, serviceUserID) {
+			return
+		}
+		credential, err := s.CreateServiceUserKey(serviceUserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeProto(w, http.StatusOK, &frontierv1beta1.CreateServiceUserKeyResponse{Key: credential})
+	case len(parts) == 5 && r.Method == http.MethodDelete:
+		if !s.httpManagesKeys(w, r, serviceUserID) {
+			return
+		}
+		s.DeleteServiceUserKey(serviceUserID, parts[4])
+		writeProto(w, http.StatusOK, &frontierv1beta1.DeleteServiceUserKeyResponse{})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// httpManagesKeys writes an error response unless caller of r may manage
+// keys of service user
+func (s *Server) httpManagesKeys(w http.ResponseWriter, r *http.Request, serviceUserID string) bool {
+	principalID, err := s.httpPrincipal(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return false
+	}
+	if principalID != serviceUserID {
+		http.Error(w, ErrPermissionDenied.Error(), http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// handleAuthToken issues access tokens to service users for a grant
+func (s *Server) handleAuthToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &frontierv1beta1.AuthTokenRequest{}
+	if err := protojson.Unmarshal(body, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, err := s.authToken(r.Context(), req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	writeProto(w, http.StatusOK, resp)
+}
+
+// authToken issues an access token for a service user assertion or secret
+func (s *Server) authToken(ctx context.Context, req *frontierv1beta1.AuthTokenRequest) (*frontierv1beta1.AuthTokenResponse, error) {
+	var principalID string
+	var err error
+	switch req.GetGrantType() {
+	case pkg.GrantTypeJWTBearer:
+		principalID, err = s.verifyToken(ctx, req.GetAssertion())
+	case pkg.GrantTypeClientCredentials:
+		principalID, err = s.secretPrincipal(req.GetClientId(), req.GetClientSecret())
+	default:
+		err = fmt.Errorf("%w: unsupported grant type %q", ErrUnauthenticated, req.GetGrantType())
+	}
+	if err != nil {
+		return nil, err
+	}
+	token, err := s.MintServiceUserAccessToken(principalID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnauthenticated, err)
+	}
+	return &frontierv1beta1.AuthTokenResponse{AccessToken: token, TokenType: "Bearer"}, nil
+}
+
+func (s *Server) httpPrincipal(r *http.Request) (string, error) {
+	var sessionID string
+	if cookie, err := r.Cookie(pkg.DefaultSessionID); err == nil {
+		sessionID = cookie.Value
+	}
+	return s.principal(r.Context(), r.Header.Get("Authorization"),
+		r.Header.Get(pkg.DefaultUserTokenHeader), sessionID)
+}
+
+func checkResource(req *frontierv1beta1.CheckResourcePermissionRequest) string {
+	if req.GetResource() != "" {
+		return req.GetResource()
+	}
+	return req.GetObjectNamespace() + ":" + req.GetObjectId()
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeProto(w http.ResponseWriter, status int, m proto.Message) {
+	body, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(m)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(body)
+}
@@ -0,0 +1,444 @@
+package frontiertest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/raystack/frontier-go/frontiertest"
+	"github.com/raystack/frontier-go/middleware"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newServer(t *testing.T) *frontiertest.Server {
+	t.Helper()
+	srv := frontiertest.NewServer()
+	t.Cleanup(srv.Close)
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1", Email: "user@raystack.org", Name: "User"})
+	return srv
+}
+
+// authenticate serves r through the authentication middleware and returns
+// the status and id of the authenticated principal
+func authenticate(t *testing.T, srv *frontiertest.Server, r *http.Request) (int, string) {
+	t.Helper()
+	authHandler, err := middleware.NewAuthHandler(middleware.WithRESTEndpoint(srv.RESTEndpoint()))
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	t.Cleanup(func() { _ = authHandler.Close() })
+
+	var principalID string
+	handler := authHandler.WithAuthentication(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, _ := r.Context().Value(middleware.AuthenticatedUserContextKey).(*frontierv1beta1.User)
+		principalID = user.GetId()
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	return rec.Code, principalID
+}
+
+func TestUserTokenVerifiedWithJWKS(t *testing.T) {
+	srv := newServer(t)
+	token, err := srv.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, user-1", code, principalID)
+	}
+
+	// tokens of another frontier are not signed with a key of the jwks
+	other := newServer(t)
+	token, err = other.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if code, _ := authenticate(t, srv, r); code != http.StatusUnauthorized {
+		t.Errorf("authenticate() with foreign token = %d, want 401", code)
+	}
+}
+
+func TestSessionResolvedThroughCurrentUser(t *testing.T) {
+	srv := newServer(t)
+	cookie, err := srv.CreateSession("user-1")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	headers := http.Header{}
+	headers.Set("Cookie", cookie.String())
+	user, token, err := pkg.GetUserProfile(context.Background(), http.DefaultClient, srv.RESTEndpoint(), headers)
+	if err != nil {
+		t.Fatalf("GetUserProfile() error = %v", err)
+	}
+	if user.GetId() != "user-1" || user.GetEmail() != "user@raystack.org" || token == "" {
+		t.Errorf("GetUserProfile() = %v, %q", user, token)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, user-1", code, principalID)
+	}
+}
+
+func TestSessionAfterKeyRotation(t *testing.T) {
+	srv := newServer(t)
+	authHandler, err := middleware.NewAuthHandler(middleware.WithRESTEndpoint(srv.RESTEndpoint()))
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	defer authHandler.Close()
+	handler := authHandler.WithAuthentication(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	cookie, err := srv.CreateSession("user-1")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+
+	// frontier signs the session token with its new key, which is not in
+	// the cached jwks yet
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d %s, want 200", i, rec.Code, rec.Body.String())
+		}
+		if _, err := srv.RotateSigningKey(false); err != nil {
+			t.Fatalf("RotateSigningKey() error = %v", err)
+		}
+	}
+}
+
+func TestCheckAccess(t *testing.T) {
+	srv := newServer(t)
+	token, err := srv.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+token)
+	check := func() bool {
+		t.Helper()
+		allowed, err := pkg.CheckAccess(context.Background(), http.DefaultClient, srv.RESTEndpoint(), headers,
+			"project:1", "update")
+		if err != nil {
+			t.Fatalf("CheckAccess() error = %v", err)
+		}
+		return allowed
+	}
+
+	if check() {
+		t.Error("CheckAccess() = true before Allow")
+	}
+	srv.Allow("user-1", "project:1", "update")
+	if !check() {
+		t.Error("CheckAccess() = false after Allow")
+	}
+	srv.Revoke("user-1", "project:1", "update")
+	if check() {
+		t.Error("CheckAccess() = true after Revoke")
+	}
+	if checks := srv.Checks(); len(checks) != 3 || !checks[1].Allowed || checks[1].PrincipalID != "user-1" {
+		t.Errorf("Checks() = %+v", checks)
+	}
+}
+
+func TestServiceUserTokenVerifiedWithKeys(t *testing.T) {
+	srv := newServer(t)
+	credential, err := srv.RegisterServiceUser("service-user-1")
+	if err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	token, err := srv.MintServiceUserToken(credential)
+	if err != nil {
+		t.Fatalf("MintServiceUserToken() error = %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "service-user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, service-user-1", code, principalID)
+	}
+
+	srv.DeleteServiceUserKey("service-user-1", credential.GetKid())
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	if code, _ := authenticate(t, srv, r); code != http.StatusUnauthorized {
+		t.Errorf("authenticate() with deleted key = %d, want 401", code)
+	}
+}
+
+func TestTokenExchange(t *testing.T) {
+	srv := newServer(t)
+	credential, err := srv.RegisterServiceUser("service-user-1")
+	if err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	assertion, err := pkg.NewServiceUserTokenSource(credential)
+	if err != nil {
+		t.Fatalf("NewServiceUserTokenSource() error = %v", err)
+	}
+	token, err := pkg.NewExchangeTokenSource(http.DefaultClient, srv.RESTEndpoint(), assertion).Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token.Expiry.IsZero() {
+		t.Error("Token() has no expiry")
+	}
+
+	// access tokens are signed by frontier, so they are verified with jwks
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token.SetAuthHeader(r)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "service-user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, service-user-1", code, principalID)
+	}
+
+	srv.DeleteServiceUserKey("service-user-1", credential.GetKid())
+	_, err = pkg.NewExchangeTokenSource(http.DefaultClient, srv.RESTEndpoint(), assertion).Token()
+	if !errors.Is(err, pkg.ErrInvalidGrant) {
+		t.Errorf("Token() with deleted key error = %v, want ErrInvalidGrant", err)
+	}
+}
+
+func TestClientCredentials(t *testing.T) {
+	srv := newServer(t)
+	if _, err := srv.RegisterServiceUser("service-user-1"); err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	secret, err := srv.CreateServiceUserSecret("service-user-1")
+	if err != nil {
+		t.Fatalf("CreateServiceUserSecret() error = %v", err)
+	}
+	token, err := pkg.NewSecretCredentialTokenSource(http.DefaultClient, srv.RESTEndpoint(), secret).Token()
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	token.SetAuthHeader(r)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "service-user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, service-user-1", code, principalID)
+	}
+
+	_, err = pkg.NewClientCredentialsTokenSource(http.DefaultClient, srv.RESTEndpoint(), secret.GetId(), "wrong").Token()
+	if !errors.Is(err, pkg.ErrInvalidGrant) {
+		t.Errorf("Token() with wrong secret error = %v, want ErrInvalidGrant", err)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	srv := newServer(t)
+	if err := srv.EnableLoginStrategy("google", "user-1"); err != nil {
+		t.Fatalf("EnableLoginStrategy() error = %v", err)
+	}
+	authHandler, err := middleware.NewAuthHandler(middleware.WithRESTEndpoint(srv.RESTEndpoint()))
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	defer authHandler.Close()
+	login, err := authHandler.NewLoginHandler("https://app.example.com/auth/callback",
+		middleware.WithLoginStateKey([]byte(strings.Repeat("k", 32))))
+	if err != nil {
+		t.Fatalf("NewLoginHandler() error = %v", err)
+	}
+	serve := func(handler http.Handler, r *http.Request) *http.Response {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Result()
+	}
+	cookie := func(resp *http.Response, name string) *http.Cookie {
+		for _, c := range resp.Cookies() {
+			if c.Name == name && c.Value != "" {
+				return c
+			}
+		}
+		t.Fatalf("response has no %s cookie", name)
+		return nil
+	}
+
+	resp := serve(login.Strategies(), httptest.NewRequest(http.MethodGet, "/auth/strategies", nil))
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"google"`) {
+		t.Errorf("Strategies() = %d %s", resp.StatusCode, body)
+	}
+
+	resp = serve(login.Login(), httptest.NewRequest(http.MethodGet, "/auth/login?strategy=google&return_to=/home", nil))
+	if resp.StatusCode != http.StatusSeeOther {
+		t.Fatalf("Login() = %d, want 303", resp.StatusCode)
+	}
+	state := cookie(resp, middleware.LoginStateCookie)
+	callback := resp.Header.Get("Location")
+
+	// frontier redirects back without the state cookie of the browser
+	resp = serve(login.Callback(), httptest.NewRequest(http.MethodGet, callback, nil))
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Callback() without state cookie = %d, want 400", resp.StatusCode)
+	}
+	r := httptest.NewRequest(http.MethodGet, callback, nil)
+	r.AddCookie(state)
+	resp = serve(login.Callback(), r)
+	if resp.StatusCode != http.StatusSeeOther || resp.Header.Get("Location") != "/home" {
+		t.Fatalf("Callback() = %d to %q, want 303 to /home", resp.StatusCode, resp.Header.Get("Location"))
+	}
+	session := cookie(resp, pkg.DefaultSessionID)
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(session)
+	if code, principalID := authenticate(t, srv, r); code != http.StatusOK || principalID != "user-1" {
+		t.Errorf("authenticate() = %d, %q, want 200, user-1", code, principalID)
+	}
+
+	r = httptest.NewRequest(http.MethodPost, "/auth/logout", nil)
+	r.AddCookie(session)
+	if resp = serve(login.Logout(), r); resp.StatusCode != http.StatusSeeOther {
+		t.Errorf("Logout() = %d, want 303", resp.StatusCode)
+	}
+	if _, ok := srv.SessionUser(session.Value); ok {
+		t.Error("session exists after Logout()")
+	}
+}
+
+// serviceUserKeyExists reports whether frontier serves public key kid
+func serviceUserKeyExists(t *testing.T, srv *frontiertest.Server, serviceUserID, kid string) bool {
+	t.Helper()
+	resp, err := http.Get(srv.RESTEndpoint().JoinPath(fmt.Sprintf(pkg.ServiceUserPublicKeyPath, serviceUserID, kid)).String())
+	if err != nil {
+		t.Fatalf("get service user key error = %v", err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode == http.StatusOK
+}
+
+func TestKeyRotation(t *testing.T) {
+	srv := newServer(t)
+	current, err := srv.RegisterServiceUser("service-user-1")
+	if err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	store, err := pkg.NewStaticCredentialProvider(current)
+	if err != nil {
+		t.Fatalf("NewStaticCredentialProvider() error = %v", err)
+	}
+	rotator := pkg.NewKeyRotator(http.DefaultClient, srv.RESTEndpoint(), store,
+		pkg.WithRotationGracePeriod(time.Millisecond))
+
+	created, err := rotator.Rotate(context.Background())
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if created.GetKid() == current.GetKid() || created.GetPrincipalId() != "service-user-1" {
+		t.Errorf("Rotate() = %v, want new key of service-user-1", created)
+	}
+	if stored, _ := store.Credential(context.Background()); stored.GetKid() != created.GetKid() {
+		t.Errorf("stored key = %q, want %q", stored.GetKid(), created.GetKid())
+	}
+	if serviceUserKeyExists(t, srv, "service-user-1", current.GetKid()) {
+		t.Error("old key not deleted")
+	}
+	if !serviceUserKeyExists(t, srv, "service-user-1", created.GetKid()) {
+		t.Error("new key deleted")
+	}
+}
+
+// refusingClient fails requests for the current user signed with a key
+// other than kid, cancelling the rotation as it does
+type refusingClient struct {
+	*http.Client
+	kid    string
+	cancel context.CancelFunc
+}
+
+func (c *refusingClient) Do(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == pkg.CurrentUserProfilePath {
+		msg, err := jws.Parse([]byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")))
+		if err == nil && msg.Signatures()[0].ProtectedHeaders().KeyID() != c.kid {
+			c.cancel()
+			return nil, errors.New("key refused")
+		}
+	}
+	return c.Client.Do(r)
+}
+
+func TestKeyRotationRollback(t *testing.T) {
+	srv := newServer(t)
+	current, err := srv.RegisterServiceUser("service-user-1")
+	if err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := pkg.NewStaticCredentialProvider(current)
+	if err != nil {
+		t.Fatalf("NewStaticCredentialProvider() error = %v", err)
+	}
+	var newKeyID string
+	rotator := pkg.NewKeyRotator(&refusingClient{Client: http.DefaultClient, kid: current.GetKid(), cancel: cancel},
+		srv.RESTEndpoint(), store, pkg.WithRotationProgress(func(event pkg.KeyRotationEvent) {
+			newKeyID = event.NewKeyID
+		}))
+
+	if _, err := rotator.Rotate(ctx); err == nil {
+		t.Fatal("Rotate() error = nil, want new key refused")
+	}
+	if stored, _ := store.Credential(context.Background()); stored.GetKid() != current.GetKid() {
+		t.Errorf("stored key = %q, want old key %q restored", stored.GetKid(), current.GetKid())
+	}
+	if newKeyID == "" || serviceUserKeyExists(t, srv, "service-user-1", newKeyID) {
+		t.Errorf("new key %q not deleted", newKeyID)
+	}
+	if !serviceUserKeyExists(t, srv, "service-user-1", current.GetKid()) {
+		t.Error("old key deleted")
+	}
+}
+
+func TestGRPC(t *testing.T) {
+	srv := newServer(t)
+	srv.Allow("user-1", "project:1", "update")
+	token, err := srv.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+
+	ctx := context.Background()
+	conn, err := srv.Dial(ctx)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Frontier.GetCurrentUser(ctx, &frontierv1beta1.GetCurrentUserRequest{}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("GetCurrentUser() without token error = %v, want Unauthenticated", err)
+	}
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	current, err := conn.Frontier.GetCurrentUser(authCtx, &frontierv1beta1.GetCurrentUserRequest{})
+	if err != nil || current.GetUser().GetId() != "user-1" {
+		t.Errorf("GetCurrentUser() = %v, %v", current, err)
+	}
+	check, err := conn.Frontier.CheckResourcePermission(authCtx, &frontierv1beta1.CheckResourcePermissionRequest{
+		Resource:   "project:1",
+		Permission: "update",
+	})
+	if err != nil || !check.GetStatus() {
+		t.Errorf("CheckResourcePermission() = %v, %v", check, err)
+	}
+	jwks, err := conn.Frontier.GetJWKs(ctx, &frontierv1beta1.GetJWKsRequest{})
+	if err != nil || len(jwks.GetKeys()) != srv.PublicKeys().Len() {
+		t.Errorf("GetJWKs() = %v, %v", jwks, err)
+	}
+}
@@ -0,0 +1,148 @@
+// Package metrics exposes prometheus metrics for middleware.AuthHandler.
+// It is a separate module so only importers pull in prometheus.
+//
+//	go get github.com/raystack/frontier-go/metrics
+//
+//	collector := metrics.NewCollector()
+//	if err := collector.Register(prometheus.DefaultRegisterer); err != nil {
+//		panic(err)
+//	}
+//	authHandler, err := middleware.NewAuthHandler(middleware.WithMetrics(collector))
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/raystack/frontier-go/middleware"
+	"strconv"
+	"time"
+)
+
+const DefaultNamespace = "frontier_sdk"
+
+var _ middleware.MetricsRecorder = (*Collector)(nil)
+
+// Collector implements middleware.MetricsRecorder using prometheus
+type Collector struct {
+	namespace string
+	buckets   []float64
+
+	authentications *prometheus.CounterVec
+	authorizations  *prometheus.CounterVec
+	frontierCalls   *prometheus.HistogramVec
+	jwksRefreshes   *prometheus.CounterVec
+	jwksLookups     *prometheus.CounterVec
+}
+
+// WithNamespace prefixes all metric names, defaults to DefaultNamespace
+func WithNamespace(namespace string) func(*Collector) {
+	return func(c *Collector) {
+		c.namespace = namespace
+	}
+}
+
+// WithLatencyBuckets overrides histogram buckets of frontier call latency in seconds
+func WithLatencyBuckets(buckets []float64) func(*Collector) {
+	return func(c *Collector) {
+		c.buckets = buckets
+	}
+}
+
+func NewCollector(opts ...func(*Collector)) *Collector {
+	c := &Collector{
+		namespace: DefaultNamespace,
+		buckets:   prometheus.DefBuckets,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+
+	c.authentications = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "authentications_total",
+		Help:      "Number of authenticated requests by method and result",
+	}, []string{"method", "result"})
+	c.authorizations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "authorizations_total",
+		Help:      "Number of authorization decisions by namespace, permission and decision",
+	}, []string{"namespace", "permission", "allowed"})
+	c.frontierCalls = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: c.namespace,
+		Name:      "frontier_call_duration_seconds",
+		Help:      "Latency of calls made to frontier by endpoint and status",
+		Buckets:   c.buckets,
+	}, []string{"endpoint", "status"})
+	c.jwksRefreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "jwks_refreshes_total",
+		Help:      "Number of jwks fetches from frontier by result",
+	}, []string{"result"})
+	c.jwksLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: c.namespace,
+		Name:      "jwks_cache_lookups_total",
+		Help:      "Number of jwks cache lookups by result, hit or miss",
+	}, []string{"result"})
+	return c
+}
+
+// Register registers all metrics on registerer
+func (c *Collector) Register(registerer prometheus.Registerer) error {
+	for _, collector := range c.collectors() {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Describe implements prometheus.Collector so Collector can be registered directly
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, collector := range c.collectors() {
+		collector.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, collector := range c.collectors() {
+		collector.Collect(ch)
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.authentications,
+		c.authorizations,
+		c.frontierCalls,
+		c.jwksRefreshes,
+		c.jwksLookups,
+	}
+}
+
+func (c *Collector) ObserveAuthentication(method, result string) {
+	c.authentications.WithLabelValues(method, result).Inc()
+}
+
+func (c *Collector) ObserveAuthorization(namespace, permission string, allowed bool) {
+	c.authorizations.WithLabelValues(namespace, permission, strconv.FormatBool(allowed)).Inc()
+}
+
+func (c *Collector) ObserveFrontierCall(endpoint, status string, duration time.Duration) {
+	c.frontierCalls.WithLabelValues(endpoint, status).Observe(duration.Seconds())
+}
+
+func (c *Collector) ObserveJWKSLookup(cacheHit bool) {
+	result := "miss"
+	if cacheHit {
+		result = "hit"
+	}
+	c.jwksLookups.WithLabelValues(result).Inc()
+}
+
+func (c *Collector) ObserveJWKSRefresh(err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	c.jwksRefreshes.WithLabelValues(result).Inc()
+}
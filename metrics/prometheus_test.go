@@ -0,0 +1,81 @@
+package metrics_test
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/raystack/frontier-go/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCollector(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	collector := metrics.NewCollector(metrics.WithLatencyBuckets([]float64{0.1, 1}))
+	if err := collector.Register(registry); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	collector.ObserveAuthentication("bearer", "success")
+	collector.ObserveAuthentication("bearer", "success")
+	collector.ObserveAuthentication("session", "invalid_session")
+	collector.ObserveAuthorization("app/project", "get", true)
+	collector.ObserveAuthorization("app/project", "delete", false)
+	collector.ObserveFrontierCall("check", "200", 50*time.Millisecond)
+	collector.ObserveJWKSLookup(true)
+	collector.ObserveJWKSLookup(false)
+	collector.ObserveJWKSRefresh(nil)
+	collector.ObserveJWKSRefresh(errors.New("unreachable"))
+
+	want := `
+# HELP frontier_sdk_authentications_total Number of authenticated requests by method and result
+# TYPE frontier_sdk_authentications_total counter
+frontier_sdk_authentications_total{method="bearer",result="success"} 2
+frontier_sdk_authentications_total{method="session",result="invalid_session"} 1
+# HELP frontier_sdk_authorizations_total Number of authorization decisions by namespace, permission and decision
+# TYPE frontier_sdk_authorizations_total counter
+frontier_sdk_authorizations_total{allowed="false",namespace="app/project",permission="delete"} 1
+frontier_sdk_authorizations_total{allowed="true",namespace="app/project",permission="get"} 1
+# HELP frontier_sdk_frontier_call_duration_seconds Latency of calls made to frontier by endpoint and status
+# TYPE frontier_sdk_frontier_call_duration_seconds histogram
+frontier_sdk_frontier_call_duration_seconds_bucket{endpoint="check",status="200",le="0.1"} 1
+frontier_sdk_frontier_call_duration_seconds_bucket{endpoint="check",status="200",le="1"} 1
+frontier_sdk_frontier_call_duration_seconds_bucket{endpoint="check",status="200",le="+Inf"} 1
+frontier_sdk_frontier_call_duration_seconds_sum{endpoint="check",status="200"} 0.05
+frontier_sdk_frontier_call_duration_seconds_count{endpoint="check",status="200"} 1
+# HELP frontier_sdk_jwks_cache_lookups_total Number of jwks cache lookups by result, hit or miss
+# TYPE frontier_sdk_jwks_cache_lookups_total counter
+frontier_sdk_jwks_cache_lookups_total{result="hit"} 1
+frontier_sdk_jwks_cache_lookups_total{result="miss"} 1
+# HELP frontier_sdk_jwks_refreshes_total Number of jwks fetches from frontier by result
+# TYPE frontier_sdk_jwks_refreshes_total counter
+frontier_sdk_jwks_refreshes_total{result="error"} 1
+frontier_sdk_jwks_refreshes_total{result="success"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCollectorNamespace(t *testing.T) {
+	registry := prometheus.NewPedanticRegistry()
+	collector := metrics.NewCollector(metrics.WithNamespace("app"))
+	// registered directly as a single prometheus.Collector
+	if err := registry.Register(collector); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	collector.ObserveJWKSRefresh(nil)
+
+	want := `
+# HELP app_jwks_refreshes_total Number of jwks fetches from frontier by result
+# TYPE app_jwks_refreshes_total counter
+app_jwks_refreshes_total{result="success"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "app_jwks_refreshes_total"); err != nil {
+		t.Error(err)
+	}
+	if err := collector.Register(registry); err == nil {
+		t.Error("Register() twice succeeded")
+	}
+}
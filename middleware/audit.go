@@ -0,0 +1,323 @@
+package middleware
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	AuditDecisionAllow = "allow"
+	AuditDecisionDeny  = "deny"
+
+	// AuditSourceFrontier decision was made by frontier check api
+	AuditSourceFrontier = "frontier"
+	// AuditSourceDefault decision was made by allow/deny by default
+	// as no resource mapping exists for the route
+	AuditSourceDefault = "default"
+
+	RequestIDHeader = "X-Request-Id"
+
+	// principalTypeCacheSize bounds the principal types remembered for audit events
+	principalTypeCacheSize = 10000
+)
+
+// AuditEvent is a single authorization decision
+type AuditEvent struct {
+	Time          time.Time     `json:"time"`
+	PrincipalID   string        `json:"principal_id"`
+	PrincipalType string        `json:"principal_type"`
+	Resource      string        `json:"resource,omitempty"`
+	Permission    string        `json:"permission,omitempty"`
+	Route         string        `json:"route"`
+	Decision      string        `json:"decision"`
+	Source        string        `json:"source"`
+	Latency       time.Duration `json:"latency_ns"`
+	RequestID     string        `json:"request_id,omitempty"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// AuditSink receives an event for every authorization decision.
+// Record is called inline with the request, wrap slow sinks with
+// NewAsyncAuditSink.
+type AuditSink interface {
+	Record(ctx context.Context, event AuditEvent)
+}
+
+// WithAuditSink records every authorization decision to sink. The handler
+// takes ownership of sink, AuthHandler.Close closes it if it is an io.Closer.
+func WithAuditSink(sink AuditSink) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.auditSink = sink
+	}
+}
+
+func (ea *AuthHandler) recordAudit(r *http.Request, user *frontierv1beta1.User, rc ResourceControl,
+	source string, allowed bool, latency time.Duration, err error) {
+	if ea.auditSink == nil {
+		return
+	}
+	event := AuditEvent{
+		Time:        time.Now().UTC(),
+		PrincipalID: user.GetId(),
+		Resource:    rc.Resource,
+		Permission:  rc.Permission,
+		Route:       r.Method + " " + r.URL.Path,
+		Decision:    AuditDecisionDeny,
+		Source:      source,
+		Latency:     latency,
+		RequestID:   r.Header.Get(RequestIDHeader),
+	}
+	event.PrincipalType = ea.principalType(r, user)
+	if allowed {
+		event.Decision = AuditDecisionAllow
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	ea.auditSink.Record(r.Context(), event)
+}
+
+// principalType returns type of the principal authenticated for r. Tokens
+// issued by frontier don't tell it, so unless the request came with a
+// session, which only users have, frontier is asked once per subject and
+// the answer kept for the most recently seen subjects.
+func (ea *AuthHandler) principalType(r *http.Request, user *frontierv1beta1.User) string {
+	claims, ok := r.Context().Value(TokenClaimsContextKey).(map[string]any)
+	if !ok {
+		return pkg.PrincipalTypeUnknown
+	}
+	if principalType := pkg.GetPrincipalType(claims); principalType != pkg.PrincipalTypeUnknown {
+		return principalType
+	}
+	if pkg.GetAuthMethod(r) == pkg.AuthMethodSession {
+		return pkg.PrincipalTypeUser
+	}
+	token, _ := r.Context().Value(UserTokenContextKey).(string)
+	if token == "" || ea.frontierHost == nil {
+		return pkg.PrincipalTypeUnknown
+	}
+
+	if principalType, ok := ea.principalTypes.get(user.GetId()); ok {
+		return principalType
+	}
+	ctx := pkg.ContextWithLogger(r.Context(), ea.logger)
+	principalType, err := pkg.LookupPrincipalType(ctx, ea.httpClient, ea.frontierHost, token)
+	if err != nil {
+		ea.logger.DebugContext(ctx, "failed to look up principal type",
+			slog.String("principal_id", user.GetId()), slog.Any("error", err))
+		return pkg.PrincipalTypeUnknown
+	}
+	ea.principalTypes.add(user.GetId(), principalType)
+	return principalType
+}
+
+// principalTypeCache remembers principal types of the most recently seen
+// subjects, evicting the least recently used one when full
+type principalTypeCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type principalTypeEntry struct {
+	subject       string
+	principalType string
+}
+
+func newPrincipalTypeCache(size int) *principalTypeCache {
+	return &principalTypeCache{
+		size:    size,
+		order:   list.New(),
+		entries: map[string]*list.Element{},
+	}
+}
+
+func (c *principalTypeCache) get(subject string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.entries[subject]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(element)
+	return element.Value.(*principalTypeEntry).principalType, true
+}
+
+func (c *principalTypeCache) add(subject, principalType string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.entries[subject]; ok {
+		element.Value.(*principalTypeEntry).principalType = principalType
+		c.order.MoveToFront(element)
+		return
+	}
+	c.entries[subject] = c.order.PushFront(&principalTypeEntry{subject: subject, principalType: principalType})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*principalTypeEntry).subject)
+	}
+}
+
+// SlogAuditSink writes audit events as structured log records
+type SlogAuditSink struct {
+	logger *slog.Logger
+	level  slog.Level
+}
+
+// NewSlogAuditSink logs events at info level using logger
+func NewSlogAuditSink(logger *slog.Logger) *SlogAuditSink {
+	return &SlogAuditSink{logger: logger, level: slog.LevelInfo}
+}
+
+func (s *SlogAuditSink) Record(ctx context.Context, event AuditEvent) {
+	s.logger.LogAttrs(ctx, s.level, "authorization decision",
+		slog.String("principal_id", event.PrincipalID),
+		slog.String("principal_type", event.PrincipalType),
+		slog.String("resource", event.Resource),
+		slog.String("permission", event.Permission),
+		slog.String("route", event.Route),
+		slog.String("decision", event.Decision),
+		slog.String("source", event.Source),
+		slog.Duration("latency", event.Latency),
+		slog.String("request_id", event.RequestID),
+		slog.String("error", event.Error),
+	)
+}
+
+// JSONLinesAuditSink appends one json encoded event per line to a file
+type JSONLinesAuditSink struct {
+	mu  sync.Mutex
+	f   *os.File
+	enc *json.Encoder
+}
+
+// NewJSONLinesAuditSink opens path for appending, creating it if needed
+func NewJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{f: f, enc: json.NewEncoder(f)}, nil
+}
+
+func (s *JSONLinesAuditSink) Record(_ context.Context, event AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// audit failures must not fail requests
+	_ = s.enc.Encode(event)
+}
+
+// Close syncs written events to disk and closes the file
+func (s *JSONLinesAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.f.Sync(), s.f.Close())
+}
+
+// AsyncAuditSink buffers events and records them on a background
+// goroutine, events are dropped when the buffer is full
+type AsyncAuditSink struct {
+	sink    AuditSink
+	events  chan AuditEvent
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// mu guards closing events against concurrent sends
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewAsyncAuditSink(sink AuditSink, bufferSize int) *AsyncAuditSink {
+	s := &AsyncAuditSink{
+		sink:   sink,
+		events: make(chan AuditEvent, bufferSize),
+		done:   make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *AsyncAuditSink) run() {
+	defer close(s.done)
+	for event := range s.events {
+		s.sink.Record(context.Background(), event)
+	}
+}
+
+func (s *AsyncAuditSink) Record(_ context.Context, event AuditEvent) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		s.dropped.Add(1)
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		s.dropped.Add(1)
+	}
+}
+
+// Dropped returns number of events dropped because the buffer was full
+// or the sink was closed
+func (s *AsyncAuditSink) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close flushes buffered events and closes the wrapped sink if it is an
+// io.Closer, events recorded after Close are dropped
+func (s *AsyncAuditSink) Close() error {
+	s.mu.Lock()
+	first := !s.closed
+	if first {
+		s.closed = true
+		close(s.events)
+	}
+	s.mu.Unlock()
+	<-s.done
+	if closer, ok := s.sink.(io.Closer); ok && first {
+		return closer.Close()
+	}
+	return nil
+}
+
+// SampledAuditSink records every denied event and only a fraction of allowed ones
+type SampledAuditSink struct {
+	sink      AuditSink
+	allowRate float64
+}
+
+// NewSampledAuditSink forwards allowed events with probability allowRate in [0, 1]
+func NewSampledAuditSink(sink AuditSink, allowRate float64) *SampledAuditSink {
+	return &SampledAuditSink{sink: sink, allowRate: allowRate}
+}
+
+func (s *SampledAuditSink) Record(ctx context.Context, event AuditEvent) {
+	if event.Decision == AuditDecisionAllow && event.Error == "" && rand.Float64() >= s.allowRate {
+		return
+	}
+	s.sink.Record(ctx, event)
+}
+
+// Close closes the wrapped sink if it is an io.Closer, e.g. to flush an
+// AsyncAuditSink
+func (s *SampledAuditSink) Close() error {
+	if closer, ok := s.sink.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"github.com/raystack/frontier-go/pkg"
+	"testing"
+)
+
+func TestPrincipalTypeCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newPrincipalTypeCache(2)
+	cache.add("user-1", pkg.PrincipalTypeUser)
+	cache.add("service-user-1", pkg.PrincipalTypeServiceUser)
+	if _, ok := cache.get("user-1"); !ok {
+		t.Fatal("get(user-1) missing")
+	}
+	cache.add("user-2", pkg.PrincipalTypeUser)
+
+	if _, ok := cache.get("service-user-1"); ok {
+		t.Error("least recently used subject not evicted")
+	}
+	for _, subject := range []string{"user-1", "user-2"} {
+		if principalType, ok := cache.get(subject); !ok || principalType != pkg.PrincipalTypeUser {
+			t.Errorf("get(%s) = %q, %v, want user", subject, principalType, ok)
+		}
+	}
+}
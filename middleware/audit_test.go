@@ -0,0 +1,38 @@
+package middleware_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raystack/frontier-go/middleware"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAsyncAuditSinkClosesWrappedSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	file, err := middleware.NewJSONLinesAuditSink(path)
+	if err != nil {
+		t.Fatalf("NewJSONLinesAuditSink() error = %v", err)
+	}
+	sink := middleware.NewAsyncAuditSink(file, 16)
+	sink.Record(context.Background(), middleware.AuditEvent{PrincipalID: "user-1", Decision: middleware.AuditDecisionAllow})
+
+	if err := sink.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := sink.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+	if err := file.Close(); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("file Close() after sink Close() error = %v, want os.ErrClosed", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(written), `"principal_id":"user-1"`) {
+		t.Errorf("audit file = %q, want the recorded event", written)
+	}
+}
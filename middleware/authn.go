@@ -5,14 +5,25 @@ import (
 	"fmt"
 	"github.com/lestrrat-go/jwx/v2/jwk"
 	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 var (
-	RestEndpoint = strings.TrimSpace(os.Getenv("FRONTIER_REST_ENDPOINT"))
+	// RestEndpoint is read from environment at import time and used by
+	// NewAuthHandler unless WithRESTEndpoint is passed.
+	//
+	// Deprecated: use pkg.LoadConfig with NewAuthHandlerFromConfig
+	RestEndpoint = strings.TrimSpace(os.Getenv(pkg.EnvRESTEndpoint))
 )
 
 type contextKey struct {
@@ -37,11 +48,60 @@ type AuthHandler struct {
 	// TODO(kushsharma): add support for multiple resource control per path
 	resourceControlStore map[ResourcePath]ResourceControlFunc
 
+	// ctx bounds background work like jwks refreshes, it is cancelled by Close
 	ctx           context.Context
+	cancel        context.CancelFunc
+	close         sync.Once
+	closeErr      error
 	frontierHost  *url.URL
 	httpClient    pkg.HTTPClient
 	denyByDefault bool
 	jwkCache      pkg.FrontierJWKCache
+
+	jwksFile         string
+	jwksFileInterval time.Duration
+	jwksPolicy       pkg.JWKSRefreshPolicy
+
+	readinessCredential *frontierv1beta1.KeyCredential
+	failFast            bool
+	failFastTimeout     time.Duration
+
+	retryPolicy    *pkg.RetryPolicy
+	callTimeout    time.Duration
+	circuitBreaker *pkg.CircuitBreaker
+	failurePolicy  FailurePolicy
+	tracer         trace.Tracer
+	metrics        MetricsRecorder
+	auditSink      AuditSink
+	logger         *slog.Logger
+
+	// principalTypes caches principal types frontier reported by subject
+	principalTypes *principalTypeCache
+
+	// authenticator and checker talk to frontier unless replaced,
+	// see NewTestAuthHandler
+	authenticator func(ctx context.Context, r *http.Request) (*frontierv1beta1.User, map[string]any, string, error)
+	checker       func(ctx context.Context, r *http.Request, rc ResourceControl) (allowed bool, source string, err error)
+}
+
+// FailurePolicy decides what happens to a request when frontier
+// can't be reached to authorize it
+type FailurePolicy int
+
+const (
+	// FailClosed rejects requests with 503 when frontier is unavailable
+	FailClosed FailurePolicy = iota
+	// FailOpen lets requests through when frontier is unavailable.
+	// Tokens are still verified, only authorization checks are skipped.
+	FailOpen
+)
+
+// WithContext sets parent context of background work started by the
+// handler, cancelling it has the same effect as calling Close
+func WithContext(ctx context.Context) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.ctx = ctx
+	}
 }
 
 // WithRESTEndpoint provides url for frontier server
@@ -76,11 +136,87 @@ func WithJWKSetCache(jwkSetCache pkg.FrontierJWKCache) func(*AuthHandler) {
 	}
 }
 
+// WithStaticJWKS verifies tokens against set without fetching keys from
+// frontier. Frontier endpoint becomes optional, without it session cookies
+// can't be used and service user keys must be present in set.
+// NewAuthHandler fails with pkg.ErrEmptyJWKS if set has no keys.
+func WithStaticJWKS(set jwk.Set) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.jwkCache = pkg.NewStaticJWKCache(set)
+	}
+}
+
+// WithJWKSFile works like WithStaticJWKS but loads keys from a json file,
+// reloading it when changed. Reload is checked every interval, a
+// non-positive interval uses pkg.DefaultWatchInterval.
+func WithJWKSFile(path string, interval time.Duration) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.jwksFile = path
+		ensureAuth.jwksFileInterval = interval
+	}
+}
+
+// WithJWKSRefreshPolicy tunes how often frontier keys are refreshed,
+// defaults to pkg.DefaultJWKSRefreshPolicy. Ignored for caches passed
+// with WithJWKSetCache.
+func WithJWKSRefreshPolicy(policy pkg.JWKSRefreshPolicy) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.jwksPolicy = policy
+	}
+}
+
+// WithRetryPolicy retries idempotent calls to frontier on transient failures
+func WithRetryPolicy(policy pkg.RetryPolicy) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.retryPolicy = &policy
+	}
+}
+
+// WithCallTimeout bounds every call made to frontier
+func WithCallTimeout(timeout time.Duration) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.callTimeout = timeout
+	}
+}
+
+// WithCircuitBreaker stops calling frontier while it keeps failing,
+// requests are then handled as per the configured FailurePolicy
+func WithCircuitBreaker(breaker *pkg.CircuitBreaker) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.circuitBreaker = breaker
+	}
+}
+
+// WithFailurePolicy configures authorization behaviour when frontier is
+// unavailable, defaults to FailClosed
+func WithFailurePolicy(policy FailurePolicy) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.failurePolicy = policy
+	}
+}
+
+// WithTracerProvider sets provider used to create spans for authentication
+// and authorization, defaults to the global otel provider
+func WithTracerProvider(tp trace.TracerProvider) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.tracer = tp.Tracer(pkg.TracerName)
+	}
+}
+
+// WithLogger sets logger used by handler and sdk calls it makes,
+// nothing is logged by default. Tokens and cookies are never logged.
+func WithLogger(logger *slog.Logger) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.logger = logger
+	}
+}
+
 // NewAuthHandler creates a middleware for net/http router that
 // checks all incoming requests for valid authorization.
 // WithAuthorization is done using either user json web token in
 // WithAuthorization header or session cookies.
-// Add this middleware on routes that needs to be protected via Frontier
+// Add this middleware on routes that needs to be protected via Frontier.
+// Close the handler once it is no longer used to stop background work.
 func NewAuthHandler(opts ...func(auth *AuthHandler)) (*AuthHandler, error) {
 	var hostURL *url.URL
 	if len(RestEndpoint) > 0 {
@@ -91,42 +227,138 @@ func NewAuthHandler(opts ...func(auth *AuthHandler)) (*AuthHandler, error) {
 		}
 	}
 
-	ea := &AuthHandler{
-		ctx:                  context.Background(),
-		resourceControlStore: map[ResourcePath]ResourceControlFunc{},
-		frontierHost:         hostURL,
-		httpClient:           http.DefaultClient,
-		denyByDefault:        true,
-	}
+	ea := newAuthHandler()
+	ea.frontierHost = hostURL
 	for _, o := range opts {
 		o(ea)
 	}
+	ea.ctx, ea.cancel = context.WithCancel(ea.ctx)
+	if err := ea.init(); err != nil {
+		ea.cancel()
+		return nil, err
+	}
+	if ea.failFast {
+		ctx := ea.ctx
+		if ea.failFastTimeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, ea.failFastTimeout)
+			defer cancel()
+		}
+		if err := ea.Ping(ctx); err != nil {
+			ea.cancel()
+			return nil, err
+		}
+	}
+	return ea, nil
+}
+
+// init validates configuration and sets up clients and caches
+func (ea *AuthHandler) init() error {
+	if ea.jwksFile != "" {
+		cache, err := pkg.NewJWKCacheFromFile(pkg.ContextWithLogger(ea.ctx, ea.logger), ea.jwksFile, ea.jwksFileInterval)
+		if err != nil {
+			return err
+		}
+		ea.jwkCache = cache
+	}
+
+	if static, ok := ea.jwkCache.(*pkg.StaticJWKCache); ok {
+		if err := static.Validate(); err != nil {
+			return err
+		}
+	}
 
-	// ensure base configurations are set
-	if len(ea.frontierHost.Host) == 0 {
-		return nil, pkg.ErrMissingHost
+	// ensure base configurations are set, frontier host can be
+	// skipped only when keys are provided locally
+	if ea.frontierHost != nil && len(ea.frontierHost.Host) == 0 {
+		ea.frontierHost = nil
+	}
+	if ea.frontierHost == nil && ea.jwkCache == nil {
+		return pkg.ErrMissingHost
+	}
+	if _, ok := ea.metrics.(noopMetrics); !ok {
+		ea.httpClient = &observedHTTPClient{client: ea.httpClient, recorder: ea.metrics}
+	}
+	if ea.retryPolicy != nil || ea.callTimeout > 0 || ea.circuitBreaker != nil {
+		var resilientOpts []func(*pkg.ResilientHTTPClient)
+		if ea.retryPolicy != nil {
+			resilientOpts = append(resilientOpts, pkg.WithRetryPolicy(*ea.retryPolicy))
+		}
+		resilientOpts = append(resilientOpts,
+			pkg.WithCallTimeout(ea.callTimeout),
+			pkg.WithCircuitBreaker(ea.circuitBreaker),
+		)
+		ea.httpClient = pkg.NewResilientHTTPClient(ea.httpClient, resilientOpts...)
 	}
 	if ea.jwkCache == nil {
-		frontierJWKsURL := fmt.Sprintf("%s/%s", ea.frontierHost, pkg.JWKSAccessPath)
+		frontierJWKsURL := ea.frontierHost.ResolveReference(&url.URL{Path: pkg.JWKSAccessPath}).String()
+		ea.logger.Debug("registering frontier jwks", slog.String("url", pkg.RedactURL(frontierJWKsURL)))
 
-		// note that by default refreshes only happen very 15 minutes at the earliest.
-		ea.jwkCache = pkg.NewJWKCacheForURL(frontierJWKsURL, ea.ctx)
-		if err := ea.jwkCache.Register(jwk.WithHTTPClient(ea.httpClient)); err != nil {
-			return nil, err
+		// note that by default refreshes only happen every 15 minutes at the earliest,
+		// unless a token signed with an unknown key forces one.
+		cache := pkg.NewJWKCacheForURL(frontierJWKsURL, pkg.ContextWithLogger(ea.ctx, ea.logger))
+		cache.SetRefreshPolicy(ea.jwksPolicy)
+		if err := cache.Register(jwk.WithHTTPClient(ea.httpClient)); err != nil {
+			return err
 		}
+		ea.jwkCache = cache
 	}
-	return ea, nil
+	return nil
+}
+
+// Close stops background work of the handler like jwks refreshes and
+// closes its audit sink if it is an io.Closer, flushing buffered events
+func (ea *AuthHandler) Close() error {
+	ea.close.Do(func() {
+		if ea.cancel != nil {
+			ea.cancel()
+		}
+		if closer, ok := ea.auditSink.(io.Closer); ok {
+			ea.closeErr = closer.Close()
+		}
+	})
+	return ea.closeErr
+}
+
+// newAuthHandler returns handler with defaults set, without validating
+// frontier configuration
+func newAuthHandler() *AuthHandler {
+	ea := &AuthHandler{
+		ctx:                  context.Background(),
+		resourceControlStore: map[ResourcePath]ResourceControlFunc{},
+		httpClient:           http.DefaultClient,
+		denyByDefault:        true,
+		tracer:               otel.GetTracerProvider().Tracer(pkg.TracerName),
+		metrics:              noopMetrics{},
+		logger:               pkg.NopLogger,
+		jwksPolicy:           pkg.DefaultJWKSRefreshPolicy,
+		principalTypes:       newPrincipalTypeCache(principalTypeCacheSize),
+	}
+	ea.authenticator = ea.authenticateWithFrontier
+	ea.checker = ea.checkWithFrontier
+	return ea
 }
 
 func (ea *AuthHandler) WithAuthentication(base http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		keySet, err := ea.jwkCache.Get(ea.ctx)
-		if err != nil {
-			http.Error(w, fmt.Errorf("%s: %w", pkg.ErrJWKsFetch, err).Error(), http.StatusUnauthorized)
-			return
-		}
-		user, claims, token, err := pkg.GetAuthenticatedUser(r, ea.httpClient, ea.frontierHost, keySet)
+		user, claims, token, err := ea.authenticate(r)
+		method, errKind := pkg.GetAuthMethod(r), ErrorKind(err)
+		ea.metrics.ObserveAuthentication(method, errKind)
 		if err != nil {
+			level := slog.LevelInfo
+			if errKind == "jwks_fetch" || errKind == "frontier_unavailable" || errKind == "internal" {
+				level = slog.LevelError
+			}
+			ea.logger.LogAttrs(r.Context(), level, "authentication failed",
+				slog.String("method", method),
+				slog.String("kind", errKind),
+				slog.String("route", r.Method+" "+r.URL.Path),
+				slog.Any("error", err),
+			)
+			if errKind == "frontier_unavailable" {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
@@ -134,8 +366,73 @@ func (ea *AuthHandler) WithAuthentication(base http.Handler) http.HandlerFunc {
 		// enrich request context
 		ctxWithUser := context.WithValue(r.Context(), AuthenticatedUserContextKey, user)
 		ctxWithToken := context.WithValue(ctxWithUser, UserTokenContextKey, token)
+		ctxWithToken = pkg.ContextWithPrincipalToken(ctxWithToken, token)
 		ctxWithClaims := context.WithValue(ctxWithToken, TokenClaimsContextKey, claims)
 		rWithUser := r.WithContext(ctxWithClaims)
 		base.ServeHTTP(w, rWithUser)
 	}
 }
+
+func (ea *AuthHandler) authenticate(r *http.Request) (user *frontierv1beta1.User, claims map[string]any, token string, err error) {
+	ctx, span := ea.tracer.Start(pkg.ContextWithLogger(r.Context(), ea.logger), "frontier.WithAuthentication")
+	defer func() {
+		if user != nil {
+			span.SetAttributes(pkg.AttributePrincipal.String(user.GetId()))
+		}
+		pkg.EndSpan(span, err)
+	}()
+	return ea.authenticator(ctx, r)
+}
+
+func (ea *AuthHandler) authenticateWithFrontier(ctx context.Context, r *http.Request) (*frontierv1beta1.User, map[string]any, string, error) {
+	return pkg.GetAuthenticatedUserWithKeySetFunc(r.WithContext(ctx), ea.httpClient, ea.frontierHost,
+		func(ctx context.Context, token string) (jwk.Set, error) {
+			keySet, err := ea.getKeySet(ctx, pkg.FrontierTokenKeyID(token))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", pkg.ErrJWKsFetch, err)
+			}
+			return keySet, nil
+		})
+}
+
+// getKeySet returns frontier keys, kid of the token being verified if any
+// is used to refresh keys when frontier rotated them
+func (ea *AuthHandler) getKeySet(ctx context.Context, kid string) (keySet jwk.Set, err error) {
+	ctx, span := pkg.StartSpan(ctx, "frontier.FetchJWKS", pkg.AttributeKeyID.String(kid))
+	defer func() { pkg.EndSpan(span, err) }()
+
+	if cached, ok := ea.jwkCache.(pkg.CachedJWKSetGetter); ok {
+		var cacheHit bool
+		keySet, cacheHit, err = cached.GetCached(ctx)
+		span.SetAttributes(pkg.AttributeCacheHit.Bool(cacheHit))
+		if err == nil {
+			ea.metrics.ObserveJWKSLookup(cacheHit)
+		}
+	} else {
+		keySet, err = ea.jwkCache.Get(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if keySet == nil {
+		return nil, pkg.ErrEmptyJWKS
+	}
+	if kid == "" {
+		return keySet, nil
+	}
+	if _, found := keySet.LookupKeyID(kid); !found {
+		if getter, ok := ea.jwkCache.(pkg.KeyIDGetter); ok {
+			return getter.GetForKeyID(ctx, kid)
+		}
+	}
+	return keySet, nil
+}
+
+// JWKSStatus returns health of the jwks cache, false if the cache
+// doesn't report it
+func (ea *AuthHandler) JWKSStatus() (pkg.JWKSStatus, bool) {
+	if reporter, ok := ea.jwkCache.(pkg.JWKSStatusReporter); ok {
+		return reporter.Status(), true
+	}
+	return pkg.JWKSStatus{}, false
+}
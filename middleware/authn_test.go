@@ -0,0 +1,260 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/raystack/frontier-go/frontiertest"
+	"github.com/raystack/frontier-go/middleware"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"go.uber.org/goleak"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recordingSink struct {
+	mu     sync.Mutex
+	events []middleware.AuditEvent
+}
+
+func (s *recordingSink) Record(_ context.Context, event middleware.AuditEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func (s *recordingSink) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.events)
+}
+
+// serve sends an authenticated request through authHandler so jwks are
+// fetched and an authorization decision is audited
+func serve(t *testing.T, srv *frontiertest.Server, authHandler *middleware.AuthHandler) {
+	t.Helper()
+	token, err := srv.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+	handler := authHandler.WithAuthentication(authHandler.WithAuthorization(
+		http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("request = %d %s, want 200", rec.Code, rec.Body.String())
+	}
+}
+
+func TestCloseStopsBackgroundWork(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	recorder := &recordingSink{}
+	authHandler, err := middleware.NewAuthHandler(
+		middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+		middleware.WithAuthzAllowByDefault(),
+		middleware.WithAuditSink(middleware.NewAsyncAuditSink(recorder, 16)),
+	)
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	serve(t, srv, authHandler)
+
+	if err := authHandler.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := authHandler.Close(); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+	if recorder.Len() != 1 {
+		t.Errorf("audit events after Close = %d, want buffered event flushed", recorder.Len())
+	}
+	http.DefaultClient.CloseIdleConnections()
+}
+
+func TestCloseFlushesSampledAsyncAuditSink(t *testing.T) {
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	recorder := &recordingSink{}
+	authHandler, err := middleware.NewAuthHandler(
+		middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+		middleware.WithAuthzAllowByDefault(),
+		middleware.WithAuditSink(middleware.NewSampledAuditSink(middleware.NewAsyncAuditSink(recorder, 16), 1)),
+	)
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	serve(t, srv, authHandler)
+
+	if err := authHandler.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if recorder.Len() != 1 {
+		t.Errorf("audit events after Close = %d, want buffered event flushed", recorder.Len())
+	}
+}
+
+func TestContextCancelStopsBackgroundWork(t *testing.T) {
+	defer goleak.VerifyNone(t)
+
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	ctx, cancel := context.WithCancel(context.Background())
+	authHandler, err := middleware.NewAuthHandler(
+		middleware.WithContext(ctx),
+		middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+		middleware.WithAuthzAllowByDefault(),
+	)
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	serve(t, srv, authHandler)
+
+	cancel()
+	http.DefaultClient.CloseIdleConnections()
+}
+
+// profileFailingClient fails current user calls like a frontier outage
+type profileFailingClient struct {
+	*http.Client
+}
+
+func (c profileFailingClient) Do(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == pkg.CurrentUserProfilePath {
+		return &http.Response{
+			StatusCode: http.StatusServiceUnavailable,
+			Status:     "503 Service Unavailable",
+			Body:       http.NoBody,
+			Request:    r,
+		}, nil
+	}
+	return c.Client.Do(r)
+}
+
+func TestSessionDuringOutage(t *testing.T) {
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	cookie, err := srv.CreateSession("user-1")
+	if err != nil {
+		t.Fatalf("CreateSession() error = %v", err)
+	}
+	authHandler, err := middleware.NewAuthHandler(
+		middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+		middleware.WithHTTPClient(profileFailingClient{Client: http.DefaultClient}),
+	)
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	defer authHandler.Close()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	rec := httptest.NewRecorder()
+	authHandler.WithAuthentication(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).ServeHTTP(rec, r)
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("request = %d %s, want 503", rec.Code, rec.Body.String())
+	}
+}
+
+// syncBuffer is a bytes.Buffer safe to log to from background goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// jwksFailingClient fails jwks fetches while failing is set
+type jwksFailingClient struct {
+	*http.Client
+	failing atomic.Bool
+}
+
+func (c *jwksFailingClient) Do(r *http.Request) (*http.Response, error) {
+	if c.failing.Load() && r.URL.Path == pkg.JWKSAccessPath {
+		return nil, errors.New("connection refused")
+	}
+	return c.Client.Do(r)
+}
+
+func (c *jwksFailingClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func TestBackgroundJWKSRefreshFailuresLogged(t *testing.T) {
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	logs := &syncBuffer{}
+	client := &jwksFailingClient{Client: http.DefaultClient}
+	authHandler, err := middleware.NewAuthHandler(
+		middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+		middleware.WithHTTPClient(client),
+		middleware.WithAuthzAllowByDefault(),
+		middleware.WithLogger(slog.New(slog.NewTextHandler(logs, nil))),
+		middleware.WithJWKSRefreshPolicy(pkg.JWKSRefreshPolicy{MaxInterval: 5 * time.Millisecond}),
+	)
+	if err != nil {
+		t.Fatalf("NewAuthHandler() error = %v", err)
+	}
+	defer authHandler.Close()
+	serve(t, srv, authHandler)
+
+	waitForLog := func(msg string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(logs.String(), msg) {
+			if time.Now().After(deadline) {
+				t.Fatalf("%q not logged, logs:\n%s", msg, logs.String())
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+	client.failing.Store(true)
+	waitForLog("jwks fetch failed")
+	// consecutive failures are logged once
+	time.Sleep(50 * time.Millisecond)
+	if n := strings.Count(logs.String(), "jwks fetch failed"); n != 1 {
+		t.Errorf("jwks fetch failure logged %d times, want 1", n)
+	}
+	client.failing.Store(false)
+	waitForLog("jwks fetch recovered")
+}
+
+func TestStaticJWKSWithoutKeysRejected(t *testing.T) {
+	for _, set := range []jwk.Set{nil, jwk.NewSet()} {
+		if _, err := middleware.NewAuthHandler(middleware.WithStaticJWKS(set)); !errors.Is(err, pkg.ErrEmptyJWKS) {
+			t.Errorf("NewAuthHandler() with jwks %v error = %v, want ErrEmptyJWKS", set, err)
+		}
+	}
+}
@@ -1,9 +1,13 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"github.com/raystack/frontier-go/pkg"
 	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 type ResourcePath struct {
@@ -23,27 +27,26 @@ type ResourceControl struct {
 func (ea *AuthHandler) WithAuthorization(base http.Handler) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// get user from context
-		_, ok := r.Context().Value(AuthenticatedUserContextKey).(*frontierv1beta1.User)
+		user, ok := r.Context().Value(AuthenticatedUserContextKey).(*frontierv1beta1.User)
 		if !ok {
 			http.Error(w, "user not found", http.StatusUnauthorized)
 			return
 		}
 
-		// find path to resource mapping
-		rc, resourceMappingExist := ea.MapRequestToResource(r)
-		if !resourceMappingExist {
-			// if no mapping found, should deny the request by default
-			if ea.denyByDefault {
-				http.Error(w, "not allowed", http.StatusUnauthorized)
-				return
-			} else {
-				base.ServeHTTP(w, r)
-				return
-			}
+		start := time.Now()
+		rc, source, allowed, err := ea.authorize(r)
+		unavailable := err != nil && (errors.Is(err, pkg.ErrFrontierUnavailable) || errors.Is(err, pkg.ErrCircuitOpen))
+		if unavailable && ea.failurePolicy == FailOpen {
+			allowed = true
 		}
+		ea.recordAudit(r, user, rc, source, allowed, time.Since(start), err)
+		ea.logDecision(r, user, rc, source, allowed, err)
 
-		allowed, err := pkg.CheckAccess(r.Context(), ea.httpClient, ea.frontierHost, r.Header, rc.Resource, rc.Permission)
-		if err != nil {
+		if err != nil && !allowed {
+			if unavailable {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -57,11 +60,66 @@ func (ea *AuthHandler) WithAuthorization(base http.Handler) http.HandlerFunc {
 	}
 }
 
+func (ea *AuthHandler) authorize(r *http.Request) (rc ResourceControl, source string, allowed bool, err error) {
+	ctx, span := ea.tracer.Start(pkg.ContextWithLogger(r.Context(), ea.logger), "frontier.WithAuthorization")
+	defer func() {
+		span.SetAttributes(pkg.AttributeDecision.Bool(allowed))
+		pkg.EndSpan(span, err)
+	}()
+
+	// find path to resource mapping
+	rc, resourceMappingExist := ea.MapRequestToResource(r)
+	if !resourceMappingExist {
+		// if no mapping found, should deny the request by default
+		return rc, AuditSourceDefault, !ea.denyByDefault, nil
+	}
+	span.SetAttributes(
+		pkg.AttributeResource.String(rc.Resource),
+		pkg.AttributePermission.String(rc.Permission),
+	)
+	allowed, source, err = ea.checker(ctx, r, rc)
+	if err == nil {
+		namespace, _ := pkg.SplitResourceID(rc.Resource)
+		ea.metrics.ObserveAuthorization(namespace, rc.Permission, allowed)
+	}
+	return rc, source, allowed, err
+}
+
+func (ea *AuthHandler) checkWithFrontier(ctx context.Context, r *http.Request, rc ResourceControl) (bool, string, error) {
+	allowed, err := pkg.CheckAccess(ctx, ea.httpClient, ea.frontierHost, r.Header, rc.Resource, rc.Permission)
+	return allowed, AuditSourceFrontier, err
+}
+
+// logDecision logs denials at info as they are expected, and frontier
+// failures at error as they need an operator
+func (ea *AuthHandler) logDecision(r *http.Request, user *frontierv1beta1.User, rc ResourceControl,
+	source string, allowed bool, err error) {
+	attrs := []slog.Attr{
+		slog.String("principal_id", user.GetId()),
+		slog.String("resource", rc.Resource),
+		slog.String("permission", rc.Permission),
+		slog.String("route", r.Method+" "+r.URL.Path),
+		slog.String("source", source),
+	}
+	switch {
+	case err != nil:
+		attrs = append(attrs, slog.Bool("allowed", allowed), slog.Any("error", err))
+		ea.logger.LogAttrs(r.Context(), slog.LevelError, "authorization check failed", attrs...)
+	case !allowed:
+		ea.logger.LogAttrs(r.Context(), slog.LevelInfo, "authorization denied", attrs...)
+	default:
+		ea.logger.LogAttrs(r.Context(), slog.LevelDebug, "authorization allowed", attrs...)
+	}
+}
+
 func (ea *AuthHandler) MapRequestToResource(r *http.Request) (ResourceControl, bool) {
 	path := ResourcePath{
 		Path:   r.URL.Path,
 		Method: r.Method,
 	}
 	rc, mappingExist := ea.resourceControlStore[path]
-	return rc(r), mappingExist
+	if !mappingExist {
+		return ResourceControl{}, false
+	}
+	return rc(r), true
 }
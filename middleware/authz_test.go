@@ -0,0 +1,72 @@
+package middleware_test
+
+import (
+	"errors"
+	"github.com/raystack/frontier-go/frontiertest"
+	"github.com/raystack/frontier-go/middleware"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// checkFailingClient fails permission checks like an unreachable frontier
+// and sends any other call on
+type checkFailingClient struct {
+	*http.Client
+}
+
+func (c checkFailingClient) Do(r *http.Request) (*http.Response, error) {
+	if r.URL.Path == pkg.CheckAccessPath {
+		return nil, errors.New("connection refused")
+	}
+	return c.Client.Do(r)
+}
+
+func TestFailurePolicy(t *testing.T) {
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	srv.RegisterUser(&frontierv1beta1.User{Id: "user-1"})
+	token, err := srv.MintUserToken("user-1")
+	if err != nil {
+		t.Fatalf("MintUserToken() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		policy middleware.FailurePolicy
+		want   int
+	}{
+		{name: "fail closed", policy: middleware.FailClosed, want: http.StatusServiceUnavailable},
+		{name: "fail open", policy: middleware.FailOpen, want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			authHandler, err := middleware.NewAuthHandler(
+				middleware.WithRESTEndpoint(srv.RESTEndpoint()),
+				middleware.WithHTTPClient(checkFailingClient{Client: http.DefaultClient}),
+				middleware.WithFailurePolicy(tt.policy),
+				middleware.WithResourceControlMapping(map[middleware.ResourcePath]middleware.ResourceControlFunc{
+					{Path: "/projects/1", Method: http.MethodGet}: func(*http.Request) middleware.ResourceControl {
+						return middleware.ResourceControl{Resource: "project:1", Permission: "get"}
+					},
+				}),
+			)
+			if err != nil {
+				t.Fatalf("NewAuthHandler() error = %v", err)
+			}
+			defer authHandler.Close()
+			handler := authHandler.WithAuthentication(authHandler.WithAuthorization(
+				http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+
+			r := httptest.NewRequest(http.MethodGet, "/projects/1", nil)
+			r.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Code != tt.want {
+				t.Errorf("request = %d %s, want %d", rec.Code, rec.Body.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
+)
+
+// NewAuthHandlerFromConfig creates handler as NewAuthHandler does with
+// settings of cfg, opts are applied after and take precedence.
+// Policy and credentials files are read once at creation.
+func NewAuthHandlerFromConfig(cfg pkg.Config, opts ...func(*AuthHandler)) (*AuthHandler, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.RESTEndpoint == "" && cfg.JWKS.File == "" {
+		return nil, fmt.Errorf("%w: rest_endpoint: required unless jwks.file is set (%s)",
+			pkg.ErrInvalidConfig, pkg.EnvRESTEndpoint)
+	}
+	hostURL, err := cfg.RESTURL()
+	if err != nil {
+		return nil, err
+	}
+
+	cfgOpts := []func(*AuthHandler){
+		WithRESTEndpoint(hostURL),
+		WithCallTimeout(cfg.CallTimeout),
+		WithJWKSRefreshPolicy(cfg.JWKS.RefreshPolicy()),
+	}
+	if cfg.JWKS.File != "" {
+		cfgOpts = append(cfgOpts, WithJWKSFile(cfg.JWKS.File, 0))
+	}
+	if cfg.PolicyFile != "" {
+		mapping, err := LoadPolicyFile(cfg.PolicyFile)
+		if err != nil {
+			return nil, err
+		}
+		cfgOpts = append(cfgOpts, WithResourceControlMapping(mapping))
+	}
+	if cfg.CredentialsFile != "" {
+		credential, err := pkg.LoadKeyCredentialFile(cfg.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfgOpts = append(cfgOpts, WithReadinessServiceUser(credential))
+	}
+	return NewAuthHandler(append(cfgOpts, opts...)...)
+}
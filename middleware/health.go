@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"net/http"
+	"time"
+)
+
+const (
+	HealthCheckJWKS        = "jwks"
+	HealthCheckFrontier    = "frontier"
+	HealthCheckServiceUser = "service_user"
+)
+
+// HealthCheck is the result of a single readiness check
+type HealthCheck struct {
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+	err   error
+}
+
+// HealthReport is returned by ReadinessHandler
+type HealthReport struct {
+	Ready  bool          `json:"ready"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// WithReadinessServiceUser makes readiness checks authenticate to frontier
+// as the service user of credential
+func WithReadinessServiceUser(credential *frontierv1beta1.KeyCredential) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.readinessCredential = credential
+	}
+}
+
+// WithFailFast makes NewAuthHandler run Ping and return its error, so a
+// misconfigured frontier is caught at startup instead of the first request
+func WithFailFast(timeout time.Duration) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.failFast = true
+		ensureAuth.failFastTimeout = timeout
+	}
+}
+
+// Ping verifies jwks can be loaded, frontier api is reachable and, if
+// configured with WithReadinessServiceUser, the service user can
+// authenticate. Errors of all failed checks are joined.
+func (ea *AuthHandler) Ping(ctx context.Context) error {
+	var errs []error
+	for _, check := range ea.healthChecks(ctx) {
+		if check.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", check.Name, check.err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Ready reports without calling frontier if the handler can serve
+// requests: jwks were loaded and their last refresh succeeded, and the
+// circuit breaker, if any, is not open. Keys are loaded lazily, use
+// WithFailFast or Ping at startup for Ready to report true before the
+// first request.
+func (ea *AuthHandler) Ready() bool {
+	if status, ok := ea.JWKSStatus(); ok && !status.Ready() {
+		return false
+	}
+	if ea.circuitBreaker != nil && ea.circuitBreaker.State() == pkg.CircuitOpen {
+		return false
+	}
+	return true
+}
+
+// ReadinessHandler serves a HealthReport of the checks done by Ping,
+// responding with 503 if any of them fails
+func (ea *AuthHandler) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := HealthReport{Ready: true, Checks: ea.healthChecks(r.Context())}
+		status := http.StatusOK
+		for _, check := range report.Checks {
+			if check.err != nil {
+				report.Ready = false
+				status = http.StatusServiceUnavailable
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
+
+func (ea *AuthHandler) healthChecks(ctx context.Context) []HealthCheck {
+	ctx = pkg.ContextWithLogger(ctx, ea.logger)
+	checks := []HealthCheck{newHealthCheck(HealthCheckJWKS, ea.pingJWKS(ctx))}
+	if ea.frontierHost != nil {
+		checks = append(checks, newHealthCheck(HealthCheckFrontier, pkg.Ping(ctx, ea.httpClient, ea.frontierHost)))
+	}
+	if ea.readinessCredential != nil {
+		checks = append(checks, newHealthCheck(HealthCheckServiceUser, ea.pingServiceUser(ctx)))
+	}
+	return checks
+}
+
+func (ea *AuthHandler) pingJWKS(ctx context.Context) error {
+	keySet, err := ea.jwkCache.Get(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %w", pkg.ErrJWKsFetch, err)
+	}
+	if status, ok := ea.JWKSStatus(); ok && status.LastError != nil {
+		return fmt.Errorf("%w: %w", pkg.ErrJWKsFetch, status.LastError)
+	}
+	if keySet == nil || keySet.Len() == 0 {
+		return fmt.Errorf("%w: no keys", pkg.ErrJWKsFetch)
+	}
+	return nil
+}
+
+func (ea *AuthHandler) pingServiceUser(ctx context.Context) error {
+	generator, err := pkg.GetServiceUserTokenGenerator(ea.readinessCredential)
+	if err != nil {
+		return err
+	}
+	token, err := generator()
+	if err != nil {
+		return err
+	}
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer "+string(token))
+	_, _, err = pkg.GetUserProfile(ctx, ea.httpClient, ea.frontierHost, headers)
+	return err
+}
+
+func newHealthCheck(name string, err error) HealthCheck {
+	check := HealthCheck{Name: name, err: err}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	return check
+}
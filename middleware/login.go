@@ -0,0 +1,405 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
+	"github.com/raystack/frontier/pkg/server/consts"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// LoginStateCookie binds a started login to the browser that started it
+	LoginStateCookie = "frontier_login_state"
+
+	DefaultLoginStateTTL = 10 * time.Minute
+)
+
+var ErrInvalidLoginState = errors.New("invalid or expired login state")
+
+// LoginHandler serves browser logins through frontier. It starts a login
+// with a strategy, completes it at callback by setting the session cookie
+// GetAuthenticatedUser reads, and logs out. Create one with
+// AuthHandler.NewLoginHandler and mount its handlers:
+//
+//	login, _ := authHandler.NewLoginHandler("https://app.example.com/auth/callback",
+//		middleware.WithLoginStateKey(stateKey))
+//	mux.Handle("/auth/strategies", login.Strategies())
+//	mux.Handle("/auth/login", login.Login())
+//	mux.Handle("/auth/callback", login.Callback())
+//	mux.Handle("/auth/logout", login.Logout())
+//
+// The started login is bound to the browser with a short lived cookie
+// signed with the state key, a callback not carrying a matching cookie is
+// rejected to prevent login CSRF.
+type LoginHandler struct {
+	client       pkg.HTTPClient
+	frontierHost *url.URL
+	logger       *slog.Logger
+
+	callbackURL        *url.URL
+	stateKey           []byte
+	stateTTL           time.Duration
+	cookieDomain       string
+	insecureCookies    bool
+	defaultReturnURL   string
+	allowedReturnHosts map[string]bool
+}
+
+// WithLoginStateKey sets key signing login state cookies, at least 32
+// bytes. Replicas serving the same app must share it, a random key is
+// generated otherwise, which only works with a single replica, and a
+// warning is logged.
+func WithLoginStateKey(key []byte) func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		l.stateKey = key
+	}
+}
+
+// WithLoginStateTTL sets how long a started login can be completed
+func WithLoginStateTTL(ttl time.Duration) func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		l.stateTTL = ttl
+	}
+}
+
+// WithSessionCookieDomain sets domain of the session cookie, e.g. to share
+// it across subdomains. Defaults to the host serving the callback.
+func WithSessionCookieDomain(domain string) func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		l.cookieDomain = domain
+	}
+}
+
+// WithInsecureCookies sets cookies without the Secure attribute, meant for
+// local development over plain http
+func WithInsecureCookies() func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		l.insecureCookies = true
+	}
+}
+
+// WithDefaultReturnURL sets where browsers are sent after login or logout
+// without a valid return url, defaults to "/"
+func WithDefaultReturnURL(returnURL string) func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		l.defaultReturnURL = returnURL
+	}
+}
+
+// WithAllowedReturnHosts allows absolute return urls on hosts, only paths
+// on the same host are allowed otherwise to prevent open redirects
+func WithAllowedReturnHosts(hosts ...string) func(*LoginHandler) {
+	return func(l *LoginHandler) {
+		for _, host := range hosts {
+			l.allowedReturnHosts[strings.ToLower(host)] = true
+		}
+	}
+}
+
+// NewLoginHandler creates a login handler talking to frontier of the auth
+// handler. callbackURL is the absolute url Callback is served at, frontier
+// must allow it as a callback url.
+func (ea *AuthHandler) NewLoginHandler(callbackURL string, opts ...func(*LoginHandler)) (*LoginHandler, error) {
+	if ea.frontierHost == nil {
+		return nil, pkg.ErrMissingHost
+	}
+	callback, err := url.Parse(callbackURL)
+	if err != nil || !callback.IsAbs() || callback.Host == "" {
+		return nil, fmt.Errorf("callback url must be absolute, got %q", callbackURL)
+	}
+	l := &LoginHandler{
+		client:             ea.httpClient,
+		frontierHost:       ea.frontierHost,
+		logger:             ea.logger,
+		callbackURL:        callback,
+		stateTTL:           DefaultLoginStateTTL,
+		defaultReturnURL:   "/",
+		allowedReturnHosts: map[string]bool{},
+	}
+	for _, o := range opts {
+		o(l)
+	}
+	if l.stateKey == nil {
+		l.stateKey = make([]byte, 32)
+		if _, err := rand.Read(l.stateKey); err != nil {
+			return nil, err
+		}
+		l.logger.Warn("no login state key set, generated a random one: " +
+			"login callbacks served by another replica or after a restart will fail")
+	}
+	if len(l.stateKey) < 32 {
+		return nil, fmt.Errorf("login state key must be at least 32 bytes, got %d", len(l.stateKey))
+	}
+	return l, nil
+}
+
+// Strategies lists login strategies enabled in frontier as json
+func (l *LoginHandler) Strategies() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		strategies, err := pkg.ListAuthStrategies(l.requestContext(r), l.client, l.frontierHost)
+		if err != nil {
+			l.writeError(w, r, "failed to list login strategies", err)
+			return
+		}
+		body, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(
+			&frontierv1beta1.ListAuthStrategiesResponse{Strategies: strategies})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(body)
+	})
+}
+
+// Login starts a login with strategy query parameter and redirects the
+// browser to it. return_to query parameter is where the browser is sent
+// after login, email is passed on for strategies like mailotp which have
+// no redirect and respond with 202 Accepted, their code is then posted to
+// Callback.
+func (l *LoginHandler) Login() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		strategy := r.FormValue("strategy")
+		if strategy == "" {
+			http.Error(w, "missing login strategy", http.StatusBadRequest)
+			return
+		}
+		resp, err := pkg.StartLogin(l.requestContext(r), l.client, l.frontierHost, &frontierv1beta1.AuthenticateRequest{
+			StrategyName: strategy,
+			CallbackUrl:  l.callbackURL.String(),
+			Email:        r.FormValue("email"),
+		})
+		if err != nil {
+			l.writeError(w, r, "failed to start login", err)
+			return
+		}
+		cookie, err := l.stateCookie(loginState{
+			Strategy: strategy,
+			State:    resp.GetState(),
+			ReturnTo: l.returnURL(r.FormValue("return_to")),
+			Expiry:   time.Now().Add(l.stateTTL).Unix(),
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.SetCookie(w, cookie)
+		w.Header().Set("Cache-Control", "no-store")
+		if resp.GetEndpoint() == "" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		http.Redirect(w, r, resp.GetEndpoint(), http.StatusSeeOther)
+	})
+}
+
+// Callback completes a login started by Login. Frontier state and code are
+// read from query parameters, as sent by oidc providers, or a posted form.
+// On success the session cookie is set and the browser is redirected to
+// the return url of the login.
+func (l *LoginHandler) Callback() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		// the state cookie is single use
+		http.SetCookie(w, l.expiredCookie(LoginStateCookie, l.callbackURL.Path))
+		state, err := l.readState(r)
+		if err != nil {
+			l.logger.DebugContext(r.Context(), "rejected login callback", slog.Any("error", err))
+			http.Error(w, ErrInvalidLoginState.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sessionID, err := pkg.FinishLogin(l.requestContext(r), l.client, l.frontierHost, &frontierv1beta1.AuthCallbackRequest{
+			StrategyName: state.Strategy,
+			State:        state.State,
+			Code:         r.FormValue("code"),
+		})
+		if err != nil {
+			l.writeError(w, r, "failed to finish login", err)
+			return
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:     pkg.DefaultSessionID,
+			Value:    sessionID,
+			Path:     "/",
+			Domain:   l.cookieDomain,
+			MaxAge:   int(consts.SessionValidity.Seconds()),
+			Secure:   !l.insecureCookies,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, state.ReturnTo, http.StatusSeeOther)
+	})
+}
+
+// Logout deletes the session in frontier, clears the session cookie and
+// redirects to return_to form value. Only POST is accepted so a link on
+// another site can't log users out.
+func (l *LoginHandler) Logout() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if cookie, err := r.Cookie(pkg.DefaultSessionID); err == nil && cookie.Value != "" {
+			if err := pkg.Logout(l.requestContext(r), l.client, l.frontierHost, cookie.Value); err != nil {
+				// the cookie is cleared anyway, session expires in frontier
+				l.logger.WarnContext(r.Context(), "failed to delete frontier session", slog.Any("error", err))
+			}
+		}
+		cookie := l.expiredCookie(pkg.DefaultSessionID, "/")
+		cookie.Domain = l.cookieDomain
+		http.SetCookie(w, cookie)
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, l.returnURL(r.FormValue("return_to")), http.StatusSeeOther)
+	})
+}
+
+func (l *LoginHandler) requestContext(r *http.Request) context.Context {
+	return pkg.ContextWithLogger(r.Context(), l.logger)
+}
+
+func (l *LoginHandler) writeError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, pkg.ErrLoginRejected):
+		l.logger.DebugContext(r.Context(), msg, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, pkg.ErrFrontierUnavailable):
+		l.logger.ErrorContext(r.Context(), msg, slog.Any("error", err))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		l.logger.ErrorContext(r.Context(), msg, slog.Any("error", err))
+		http.Error(w, pkg.ErrInternalServer.Error(), http.StatusInternalServerError)
+	}
+}
+
+// returnURL returns raw if it is safe to redirect to: a path on this host
+// or a url on an allowed host. Anything else falls back to the default.
+func (l *LoginHandler) returnURL(raw string) string {
+	if raw == "" || strings.ContainsAny(raw, "\\\r\n\t") {
+		return l.defaultReturnURL
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return l.defaultReturnURL
+	}
+	// "//host" is a url on another host, not a path
+	if u.Scheme == "" && u.Host == "" && strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return raw
+	}
+	secure := u.Scheme == "https" || (u.Scheme == "http" && l.insecureCookies)
+	if secure && u.User == nil && l.allowedReturnHosts[strings.ToLower(u.Hostname())] {
+		return raw
+	}
+	return l.defaultReturnURL
+}
+
+// loginState is kept in LoginStateCookie between Login and Callback
+type loginState struct {
+	Strategy string `json:"strategy"`
+	State    string `json:"state"`
+	ReturnTo string `json:"return_to"`
+	Expiry   int64  `json:"exp"`
+}
+
+func (l *LoginHandler) stateCookie(state loginState) (*http.Cookie, error) {
+	raw, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(raw)
+	return &http.Cookie{
+		Name:     LoginStateCookie,
+		Value:    payload + "." + base64.RawURLEncoding.EncodeToString(l.sign(payload)),
+		Path:     l.callbackURL.Path,
+		MaxAge:   int(l.stateTTL.Seconds()),
+		Secure:   !l.insecureCookies,
+		HttpOnly: true,
+		// sent along the top level redirect back from the login provider
+		SameSite: http.SameSiteLaxMode,
+	}, nil
+}
+
+// readState verifies the state cookie of r and that frontier state in r
+// is the one the login was started with
+func (l *LoginHandler) readState(r *http.Request) (loginState, error) {
+	var state loginState
+	cookie, err := r.Cookie(LoginStateCookie)
+	if err != nil {
+		return state, fmt.Errorf("%w: missing state cookie", ErrInvalidLoginState)
+	}
+	payload, signature, ok := strings.Cut(cookie.Value, ".")
+	if !ok {
+		return state, ErrInvalidLoginState
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, l.sign(payload)) {
+		return state, fmt.Errorf("%w: bad signature", ErrInvalidLoginState)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return state, ErrInvalidLoginState
+	}
+	if err := json.Unmarshal(raw, &state); err != nil {
+		return state, ErrInvalidLoginState
+	}
+	if time.Now().Unix() > state.Expiry {
+		return state, fmt.Errorf("%w: expired", ErrInvalidLoginState)
+	}
+	// redirects from a login provider must echo the state, only a posted
+	// code can rely on the cookie alone as lax cookies aren't sent along
+	// cross site posts
+	got := r.FormValue("state")
+	if got == "" && r.Method == http.MethodPost {
+		return state, nil
+	}
+	if subtle.ConstantTimeCompare([]byte(got), []byte(state.State)) != 1 {
+		return state, fmt.Errorf("%w: state mismatch", ErrInvalidLoginState)
+	}
+	return state, nil
+}
+
+func (l *LoginHandler) sign(payload string) []byte {
+	h := hmac.New(sha256.New, l.stateKey)
+	h.Write([]byte(payload))
+	return h.Sum(nil)
+}
+
+func (l *LoginHandler) expiredCookie(name, path string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    "",
+		Path:     path,
+		MaxAge:   -1,
+		Secure:   !l.insecureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	}
+}
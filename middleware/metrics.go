@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MetricsRecorder receives auth outcomes from AuthHandler,
+// see metrics package for a prometheus implementation
+type MetricsRecorder interface {
+	// ObserveAuthentication is called once per authenticated request
+	// result is either "success" or an error kind, see ErrorKind
+	ObserveAuthentication(method, result string)
+	// ObserveAuthorization is called once per authorization decision
+	ObserveAuthorization(namespace, permission string, allowed bool)
+	// ObserveFrontierCall is called for every http call made to frontier,
+	// status is the http status code or "error" if call failed
+	ObserveFrontierCall(endpoint, status string, duration time.Duration)
+	// ObserveJWKSLookup is called when jwks are read from cache
+	ObserveJWKSLookup(cacheHit bool)
+	// ObserveJWKSRefresh is called when jwks are fetched from frontier
+	ObserveJWKSRefresh(err error)
+}
+
+// WithMetrics records authentication, authorization and frontier call metrics
+func WithMetrics(recorder MetricsRecorder) func(*AuthHandler) {
+	return func(ensureAuth *AuthHandler) {
+		ensureAuth.metrics = recorder
+	}
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveAuthentication(string, string)              {}
+func (noopMetrics) ObserveAuthorization(string, string, bool)         {}
+func (noopMetrics) ObserveFrontierCall(string, string, time.Duration) {}
+func (noopMetrics) ObserveJWKSLookup(bool)                            {}
+func (noopMetrics) ObserveJWKSRefresh(error)                          {}
+
+// ErrorKind maps authentication errors to a low cardinality label
+func ErrorKind(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, pkg.ErrJWKsFetch):
+		return "jwks_fetch"
+	case errors.Is(err, pkg.ErrInvalidHeader):
+		return "missing_credentials"
+	// an outage can surface while verifying a session or token, it is
+	// still an outage
+	case errors.Is(err, pkg.ErrCircuitOpen), errors.Is(err, pkg.ErrFrontierUnavailable):
+		return "frontier_unavailable"
+	case errors.Is(err, pkg.ErrInvalidSession):
+		return "invalid_session"
+	case errors.Is(err, pkg.ErrInvalidToken):
+		return "invalid_token"
+	}
+	return "internal"
+}
+
+// EndpointName maps a frontier url path to a low cardinality label
+func EndpointName(path string) string {
+	switch {
+	case path == pkg.CheckAccessPath:
+		return "check"
+	case path == pkg.CurrentUserProfilePath:
+		return "user_profile"
+	case strings.HasSuffix(path, pkg.JWKSAccessPath):
+		return "jwks"
+	case strings.HasPrefix(path, strings.Split(pkg.ServiceUserPublicKeyPath, "%s")[0]):
+		return "serviceuser_keys"
+	}
+	return "other"
+}
+
+// observedHTTPClient reports latency of every call made to frontier
+type observedHTTPClient struct {
+	client   pkg.HTTPClient
+	recorder MetricsRecorder
+}
+
+func (c *observedHTTPClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *observedHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := c.client.Do(r)
+
+	endpoint := EndpointName(r.URL.Path)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	}
+	c.recorder.ObserveFrontierCall(endpoint, status, time.Since(start))
+	if endpoint == "jwks" {
+		if err == nil && resp.StatusCode != http.StatusOK {
+			c.recorder.ObserveJWKSRefresh(fmt.Errorf("%w: %s", pkg.ErrJWKsFetch, resp.Status))
+		} else {
+			c.recorder.ObserveJWKSRefresh(err)
+		}
+	}
+	return resp, err
+}
@@ -0,0 +1,31 @@
+package middleware_test
+
+import (
+	"errors"
+	"fmt"
+	"github.com/raystack/frontier-go/middleware"
+	"github.com/raystack/frontier-go/pkg"
+	"testing"
+)
+
+func TestErrorKind(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: "success"},
+		{err: fmt.Errorf("%w: timeout", pkg.ErrJWKsFetch), want: "jwks_fetch"},
+		{err: pkg.ErrInvalidHeader, want: "missing_credentials"},
+		{err: fmt.Errorf("%w : %w", pkg.ErrInvalidSession, pkg.ErrInternalServer), want: "invalid_session"},
+		{err: fmt.Errorf("%w : %w", pkg.ErrInvalidSession, pkg.ErrFrontierUnavailable), want: "frontier_unavailable"},
+		{err: fmt.Errorf("%w: 404 Not Found", pkg.ErrInvalidToken), want: "invalid_token"},
+		{err: fmt.Errorf("%w: %w", pkg.ErrFrontierUnavailable, errors.New("connection refused")), want: "frontier_unavailable"},
+		{err: pkg.ErrCircuitOpen, want: "frontier_unavailable"},
+		{err: errors.New("boom"), want: "internal"},
+	}
+	for _, tt := range tests {
+		if got := middleware.ErrorKind(tt.err); got != tt.want {
+			t.Errorf("ErrorKind(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
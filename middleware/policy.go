@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// policyPlaceholder matches {query.name} and {header.name} in rule resources
+var policyPlaceholder = regexp.MustCompile(`\{([a-z]+)\.([^{}]+)\}`)
+
+// PolicyRule maps a route to the permission checked on a resource
+type PolicyRule struct {
+	Method string `yaml:"method"`
+	Path   string `yaml:"path"`
+	// Resource is in the form of "object_namespace:object_id", id can be read
+	// from the request with {query.<name>} or {header.<name>} placeholders
+	// for e.g. "organization:{query.org_id}"
+	Resource   string `yaml:"resource"`
+	Permission string `yaml:"permission"`
+}
+
+// Policy is a set of rules, usually loaded from a yaml file
+//
+//	rules:
+//	  - method: GET
+//	    path: /ping
+//	    resource: organization:{query.org_id}
+//	    permission: get
+type Policy struct {
+	Rules []PolicyRule `yaml:"rules"`
+}
+
+// LoadPolicyFile reads a yaml policy and returns it as resource control
+// mapping, see WithResourceControlMapping
+func LoadPolicyFile(path string) (map[ResourcePath]ResourceControlFunc, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := ParsePolicy(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return mapping, nil
+}
+
+// ParsePolicy parses a yaml policy, see Policy for the format
+func ParsePolicy(raw []byte) (map[ResourcePath]ResourceControlFunc, error) {
+	policy := Policy{}
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, err)
+	}
+	return policy.Mapping()
+}
+
+// Mapping validates rules and converts them to resource control mapping
+func (p Policy) Mapping() (map[ResourcePath]ResourceControlFunc, error) {
+	var errs []error
+	mapping := map[ResourcePath]ResourceControlFunc{}
+	for i, rule := range p.Rules {
+		if err := rule.validate(); err != nil {
+			errs = append(errs, fmt.Errorf("rule %d: %w", i, err))
+			continue
+		}
+		path := ResourcePath{Path: rule.Path, Method: strings.ToUpper(rule.Method)}
+		if _, ok := mapping[path]; ok {
+			errs = append(errs, fmt.Errorf("rule %d: duplicate rule for %s %s", i, path.Method, path.Path))
+			continue
+		}
+		mapping[path] = rule.resourceControl
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPolicy, errors.Join(errs...))
+	}
+	return mapping, nil
+}
+
+func (r PolicyRule) validate() error {
+	switch {
+	case r.Method == "":
+		return errors.New("method is required")
+	case !strings.HasPrefix(r.Path, "/"):
+		return fmt.Errorf("path %q must start with /", r.Path)
+	case r.Permission == "":
+		return errors.New("permission is required")
+	}
+	namespace, id, ok := strings.Cut(r.Resource, ":")
+	if !ok || namespace == "" || id == "" {
+		return fmt.Errorf("resource %q must be in the form namespace:id", r.Resource)
+	}
+	for _, match := range policyPlaceholder.FindAllStringSubmatch(r.Resource, -1) {
+		if match[1] != "query" && match[1] != "header" {
+			return fmt.Errorf("resource %q: unknown placeholder source %q, use query or header", r.Resource, match[1])
+		}
+	}
+	return nil
+}
+
+func (r PolicyRule) resourceControl(req *http.Request) ResourceControl {
+	resource := policyPlaceholder.ReplaceAllStringFunc(r.Resource, func(placeholder string) string {
+		match := policyPlaceholder.FindStringSubmatch(placeholder)
+		if match[1] == "header" {
+			return req.Header.Get(match[2])
+		}
+		return req.URL.Query().Get(match[2])
+	})
+	return ResourceControl{
+		Resource:   resource,
+		Permission: r.Permission,
+	}
+}
@@ -0,0 +1,96 @@
+package middleware_test
+
+import (
+	"errors"
+	"github.com/raystack/frontier-go/middleware"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePolicy(t *testing.T) {
+	mapping, err := middleware.ParsePolicy([]byte(`
+rules:
+  - method: get
+    path: /projects
+    resource: organization:{query.org_id}
+    permission: get
+  - method: DELETE
+    path: /projects
+    resource: project:{header.X-Project-Id}
+    permission: delete
+`))
+	if err != nil {
+		t.Fatalf("ParsePolicy() error = %v", err)
+	}
+
+	tests := []struct {
+		method string
+		header http.Header
+		want   middleware.ResourceControl
+	}{
+		{method: http.MethodGet, want: middleware.ResourceControl{Resource: "organization:org-1", Permission: "get"}},
+		{method: http.MethodDelete, header: http.Header{"X-Project-Id": {"p-1"}},
+			want: middleware.ResourceControl{Resource: "project:p-1", Permission: "delete"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			control, ok := mapping[middleware.ResourcePath{Path: "/projects", Method: tt.method}]
+			if !ok {
+				t.Fatalf("no rule for %s /projects", tt.method)
+			}
+			r := httptest.NewRequest(tt.method, "/projects?org_id=org-1", nil)
+			for name, values := range tt.header {
+				r.Header[name] = values
+			}
+			if got := control(r); got != tt.want {
+				t.Errorf("resource control = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePolicyInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr string
+	}{
+		{name: "unknown field", policy: "rules: [{method: GET, path: /a, resource: a:1, permission: get, role: admin}]", wantErr: "role"},
+		{name: "missing method", policy: "rules: [{path: /a, resource: a:1, permission: get}]", wantErr: "method is required"},
+		{name: "relative path", policy: "rules: [{method: GET, path: a, resource: a:1, permission: get}]", wantErr: "must start with /"},
+		{name: "missing permission", policy: "rules: [{method: GET, path: /a, resource: a:1}]", wantErr: "permission is required"},
+		{name: "resource without id", policy: "rules: [{method: GET, path: /a, resource: a, permission: get}]", wantErr: "namespace:id"},
+		{name: "unknown placeholder", policy: "rules: [{method: GET, path: /a, resource: 'a:{body.id}', permission: get}]", wantErr: "placeholder"},
+		{name: "duplicate rule", policy: "rules: [{method: GET, path: /a, resource: a:1, permission: get}, {method: get, path: /a, resource: a:2, permission: get}]",
+			wantErr: "duplicate rule"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := middleware.ParsePolicy([]byte(tt.policy))
+			if !errors.Is(err, middleware.ErrInvalidPolicy) {
+				t.Fatalf("ParsePolicy() error = %v, want ErrInvalidPolicy", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParsePolicy() error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(path, []byte("rules: [{method: GET, path: /a, resource: a, permission: get}]"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := middleware.LoadPolicyFile(path)
+	if !errors.Is(err, middleware.ErrInvalidPolicy) || !strings.Contains(err.Error(), path) {
+		t.Errorf("LoadPolicyFile() error = %v, want ErrInvalidPolicy naming the file", err)
+	}
+	if _, err := middleware.LoadPolicyFile(filepath.Join(t.TempDir(), "missing.yaml")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("LoadPolicyFile() error = %v, want os.ErrNotExist", err)
+	}
+}
@@ -0,0 +1,177 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"net/http"
+	"sync"
+)
+
+// AuditSourceStatic decision was made by the in-memory permission table
+// of a TestAuthHandler
+const AuditSourceStatic = "static"
+
+// TB is the part of testing.TB used by assertions of TestAuthHandler, so
+// the package doesn't pull testing into binaries using the middleware
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// PermissionCheck is an authorization check performed by TestAuthHandler
+type PermissionCheck struct {
+	PrincipalID string
+	Resource    string
+	Permission  string
+	Allowed     bool
+}
+
+// TestAuthHandler is an AuthHandler for unit tests that never talks to
+// frontier. Every request is authenticated as the configured principal
+// and checks are answered from permissions declared with Allow.
+//
+//	authHandler := middleware.NewTestAuthHandler(&frontierv1beta1.User{Id: "user-1"},
+//		middleware.WithResourceControlMapping(mapping))
+//	authHandler.Allow("project:1", "update")
+//	handler := authHandler.WithAuthentication(authHandler.WithAuthorization(router))
+//	...
+//	authHandler.AssertChecked(t, "project:1", "update")
+type TestAuthHandler struct {
+	*AuthHandler
+
+	mu          sync.Mutex
+	principal   *frontierv1beta1.User
+	claims      map[string]any
+	permissions map[string]map[string]bool
+	checks      []PermissionCheck
+}
+
+// NewTestAuthHandler creates a handler authenticating every request as
+// principal, a nil principal rejects every request as unauthenticated.
+// Options are applied as in NewAuthHandler, frontier endpoints are ignored.
+func NewTestAuthHandler(principal *frontierv1beta1.User, opts ...func(*AuthHandler)) *TestAuthHandler {
+	t := &TestAuthHandler{
+		AuthHandler: newAuthHandler(),
+		permissions: map[string]map[string]bool{},
+	}
+	t.SetPrincipal(principal)
+	for _, o := range opts {
+		o(t.AuthHandler)
+	}
+	t.AuthHandler.authenticator = t.authenticate
+	t.AuthHandler.checker = t.check
+	return t
+}
+
+// SetPrincipal changes the principal injected in following requests
+func (t *TestAuthHandler) SetPrincipal(principal *frontierv1beta1.User) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.principal = principal
+	t.claims = nil
+	if principal != nil {
+		t.claims = map[string]any{
+			"sub":   principal.GetId(),
+			"email": principal.GetEmail(),
+			"name":  principal.GetName(),
+			"gen":   "system",
+		}
+	}
+}
+
+// Allow grants the principal permission on resource, resource is in the
+// form of "namespace:id"
+func (t *TestAuthHandler) Allow(resource, permission string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.permissions[resource] == nil {
+		t.permissions[resource] = map[string]bool{}
+	}
+	t.permissions[resource][permission] = true
+}
+
+// Revoke removes a permission granted with Allow
+func (t *TestAuthHandler) Revoke(resource, permission string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.permissions[resource], permission)
+}
+
+// Checks returns all authorization checks performed so far in order
+func (t *TestAuthHandler) Checks() []PermissionCheck {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]PermissionCheck(nil), t.checks...)
+}
+
+// Checked reports if permission on resource was checked at least once
+func (t *TestAuthHandler) Checked(resource, permission string) bool {
+	for _, c := range t.Checks() {
+		if c.Resource == resource && c.Permission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// Reset forgets recorded checks, declared permissions are kept
+func (t *TestAuthHandler) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checks = nil
+}
+
+// AssertChecked fails the test if permission on resource was never checked
+func (t *TestAuthHandler) AssertChecked(tb TB, resource, permission string) {
+	tb.Helper()
+	if !t.Checked(resource, permission) {
+		tb.Errorf("expected check of %q on %q, got checks: %s", permission, resource, t.formatChecks())
+	}
+}
+
+// AssertNotChecked fails the test if permission on resource was checked
+func (t *TestAuthHandler) AssertNotChecked(tb TB, resource, permission string) {
+	tb.Helper()
+	if t.Checked(resource, permission) {
+		tb.Errorf("unexpected check of %q on %q", permission, resource)
+	}
+}
+
+func (t *TestAuthHandler) formatChecks() string {
+	checks := t.Checks()
+	if len(checks) == 0 {
+		return "none"
+	}
+	out := ""
+	for i, c := range checks {
+		if i > 0 {
+			out += ", "
+		}
+		out += fmt.Sprintf("%s on %s (allowed=%t)", c.Permission, c.Resource, c.Allowed)
+	}
+	return out
+}
+
+func (t *TestAuthHandler) authenticate(_ context.Context, _ *http.Request) (*frontierv1beta1.User, map[string]any, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.principal == nil {
+		return nil, nil, "", pkg.ErrInvalidHeader
+	}
+	return t.principal, t.claims, "", nil
+}
+
+func (t *TestAuthHandler) check(_ context.Context, _ *http.Request, rc ResourceControl) (bool, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	allowed := t.permissions[rc.Resource][rc.Permission]
+	t.checks = append(t.checks, PermissionCheck{
+		PrincipalID: t.principal.GetId(),
+		Resource:    rc.Resource,
+		Permission:  rc.Permission,
+		Allowed:     allowed,
+	})
+	return allowed, AuditSourceStatic, nil
+}
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"golang.org/x/oauth2"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	// GrantTypeJWTBearer exchanges a service user token for an access token
+	GrantTypeJWTBearer = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+	// GrantTypeClientCredentials trades a service user secret for an access token
+	GrantTypeClientCredentials = "client_credentials"
+
+	DefaultAccessTokenRefreshMargin = 30 * time.Second
+)
+
+// RequestAccessToken asks frontier to issue an access token for grant in
+// req. Access tokens are signed with frontier keys and carry gen: system,
+// so services verify them against frontier jwks alone.
+func RequestAccessToken(ctx context.Context, client HTTPClient, frontierHost *url.URL,
+	req *frontierv1beta1.AuthTokenRequest) (token *oauth2.Token, err error) {
+	ctx, span := StartSpan(ctx, "frontier.RequestAccessToken")
+	defer func() { EndSpan(span, err) }()
+
+	if frontierHost == nil {
+		return nil, ErrMissingHost
+	}
+	body, err := protojson.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	tokenRequest, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		frontierHost.ResolveReference(&url.URL{Path: AuthTokenPath}).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	tokenRequest.Header.Set("Content-Type", "application/json")
+	InjectTraceContext(ctx, tokenRequest.Header)
+	resp, err := client.Do(tokenRequest)
+	if err != nil {
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier auth token call failed", slog.Any("error", err))
+		return nil, fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusNotFound:
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier rejected auth token grant",
+			slog.String("grant_type", req.GetGrantType()), slog.Int("status", resp.StatusCode))
+		return nil, fmt.Errorf("%w: %s", ErrInvalidGrant, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedResponse, resp.Status)
+	}
+
+	tokenResp := &frontierv1beta1.AuthTokenResponse{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, tokenResp); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	// response doesn't tell the expiry, read it from the token frontier signed
+	accessToken, err := jwt.ParseInsecure([]byte(tokenResp.GetAccessToken()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	if accessToken.Expiration().IsZero() {
+		return nil, fmt.Errorf("%w: access token has no expiry", ErrUnexpectedResponse)
+	}
+	tokenType := tokenResp.GetTokenType()
+	if tokenType == "" {
+		tokenType = "Bearer"
+	}
+	return &oauth2.Token{
+		AccessToken: tokenResp.GetAccessToken(),
+		TokenType:   tokenType,
+		Expiry:      accessToken.Expiration(),
+	}, nil
+}
+
+// FrontierTokenSource is an oauth2.TokenSource of frontier issued access
+// tokens. A token is reused until it is about to expire, then a new one
+// is requested. It is safe for concurrent use.
+type FrontierTokenSource struct {
+	client        HTTPClient
+	host          *url.URL
+	refreshMargin time.Duration
+	// grant builds the request for a new token
+	grant func() (*frontierv1beta1.AuthTokenRequest, error)
+	// refreshGrant, if set, is called once a grant is rejected to get
+	// new credentials for another attempt
+	refreshGrant func()
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// WithAccessTokenRefreshMargin requests a new access token margin before
+// the current one expires
+func WithAccessTokenRefreshMargin(margin time.Duration) func(*FrontierTokenSource) {
+	return func(s *FrontierTokenSource) {
+		s.refreshMargin = margin
+	}
+}
+
+// NewExchangeTokenSource exchanges tokens of assertion, usually a
+// ServiceUserTokenSource, for frontier access tokens. If frontier rejects
+// an assertion and assertion implements TokenInvalidator, a fresh one is
+// tried once, e.g. after its key was rotated.
+func NewExchangeTokenSource(client HTTPClient, frontierHost *url.URL, assertion oauth2.TokenSource,
+	opts ...func(*FrontierTokenSource)) *FrontierTokenSource {
+	s := newFrontierTokenSource(client, frontierHost, func() (*frontierv1beta1.AuthTokenRequest, error) {
+		token, err := assertion.Token()
+		if err != nil {
+			return nil, err
+		}
+		return &frontierv1beta1.AuthTokenRequest{
+			GrantType: GrantTypeJWTBearer,
+			Assertion: token.AccessToken,
+		}, nil
+	}, opts...)
+	if invalidator, ok := assertion.(TokenInvalidator); ok {
+		s.refreshGrant = invalidator.Invalidate
+	}
+	return s
+}
+
+// NewClientCredentialsTokenSource requests frontier access tokens with the
+// client credentials grant, clientID and clientSecret are the id and value
+// of a service user secret. It can be used wherever a
+// ServiceUserTokenSource is, e.g. with NewTransport or oauth2.NewClient.
+func NewClientCredentialsTokenSource(client HTTPClient, frontierHost *url.URL, clientID, clientSecret string,
+	opts ...func(*FrontierTokenSource)) *FrontierTokenSource {
+	return newFrontierTokenSource(client, frontierHost, func() (*frontierv1beta1.AuthTokenRequest, error) {
+		if clientID == "" || clientSecret == "" {
+			return nil, fmt.Errorf("%w: missing client id or secret", ErrInvalidCredential)
+		}
+		return &frontierv1beta1.AuthTokenRequest{
+			GrantType:    GrantTypeClientCredentials,
+			ClientId:     clientID,
+			ClientSecret: clientSecret,
+		}, nil
+	}, opts...)
+}
+
+// NewSecretCredentialTokenSource is NewClientCredentialsTokenSource for a
+// secret credential as returned by frontier, see LoadSecretCredential
+func NewSecretCredentialTokenSource(client HTTPClient, frontierHost *url.URL, credential *frontierv1beta1.SecretCredential,
+	opts ...func(*FrontierTokenSource)) *FrontierTokenSource {
+	return NewClientCredentialsTokenSource(client, frontierHost, credential.GetId(), credential.GetSecret(), opts...)
+}
+
+func newFrontierTokenSource(client HTTPClient, frontierHost *url.URL,
+	grant func() (*frontierv1beta1.AuthTokenRequest, error),
+	opts ...func(*FrontierTokenSource)) *FrontierTokenSource {
+	s := &FrontierTokenSource{
+		client:        client,
+		host:          frontierHost,
+		refreshMargin: DefaultAccessTokenRefreshMargin,
+		grant:         grant,
+	}
+	for _, o := range opts {
+		o(s)
+	}
+	return s
+}
+
+// Token returns a valid access token, requesting a new one if needed
+func (s *FrontierTokenSource) Token() (*oauth2.Token, error) {
+	return s.TokenContext(context.Background())
+}
+
+// TokenContext is Token with ctx used for the request to frontier
+func (s *FrontierTokenSource) TokenContext(ctx context.Context) (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != nil && time.Until(s.token.Expiry) > s.refreshMargin {
+		return s.token, nil
+	}
+
+	token, err := s.requestToken(ctx)
+	if errors.Is(err, ErrInvalidGrant) && s.refreshGrant != nil {
+		s.refreshGrant()
+		token, err = s.requestToken(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.token = token
+	return token, nil
+}
+
+func (s *FrontierTokenSource) requestToken(ctx context.Context) (*oauth2.Token, error) {
+	req, err := s.grant()
+	if err != nil {
+		return nil, err
+	}
+	return RequestAccessToken(ctx, s.client, s.host, req)
+}
+
+// Invalidate drops the cached token, next call to Token requests a new one
+func (s *FrontierTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
+}
@@ -0,0 +1,54 @@
+package pkg_test
+
+import (
+	"github.com/raystack/frontier-go/pkg"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	breaker := pkg.NewCircuitBreaker(2, 20*time.Millisecond)
+	assertState := func(want pkg.CircuitState) {
+		t.Helper()
+		if state := breaker.State(); state != want {
+			t.Fatalf("State() = %s, want %s", state, want)
+		}
+	}
+
+	breaker.Failure()
+	assertState(pkg.CircuitClosed)
+	breaker.Success()
+	breaker.Failure()
+	assertState(pkg.CircuitClosed)
+	breaker.Failure()
+	assertState(pkg.CircuitOpen)
+	if breaker.Allow() {
+		t.Error("Allow() = true with open circuit")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Allow() = false once open duration passed")
+	}
+	assertState(pkg.CircuitHalfOpen)
+	if breaker.Allow() {
+		t.Error("Allow() = true during probe")
+	}
+	// a cancelled probe tells nothing, another one is let through
+	breaker.Ignore()
+	if !breaker.Allow() {
+		t.Error("Allow() = false after ignored probe")
+	}
+	breaker.Failure()
+	assertState(pkg.CircuitOpen)
+
+	time.Sleep(20 * time.Millisecond)
+	if !breaker.Allow() {
+		t.Fatal("Allow() = false once open duration passed")
+	}
+	breaker.Success()
+	assertState(pkg.CircuitClosed)
+	if !breaker.Allow() || !breaker.Allow() {
+		t.Error("Allow() = false with closed circuit")
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -12,7 +14,19 @@ import (
 
 // CheckAccess uses frontier api to check if user has access to perform action on resource
 func CheckAccess(ctx context.Context, client HTTPClient, frontierHost *url.URL, headers http.Header,
-	resourceID string, permission string) (bool, error) {
+	resourceID string, permission string) (allowed bool, err error) {
+	ctx, span := StartSpan(ctx, "frontier.CheckAccess",
+		AttributeResource.String(resourceID),
+		AttributePermission.String(permission),
+	)
+	defer func() {
+		span.SetAttributes(AttributeDecision.Bool(allowed))
+		EndSpan(span, err)
+	}()
+
+	if frontierHost == nil {
+		return false, ErrMissingHost
+	}
 	requestBodyBytes, err := json.Marshal(&frontierv1beta1.CheckResourcePermissionRequest{
 		Resource:   resourceID,
 		Permission: permission,
@@ -21,23 +35,34 @@ func CheckAccess(ctx context.Context, client HTTPClient, frontierHost *url.URL,
 		return false, err
 	}
 
-	// send the request to auth server
-	checkAccessRequest, err := http.NewRequestWithContext(ctx, http.MethodPost,
+	// send the request to auth server, checks don't mutate state so are safe to retry
+	checkAccessRequest, err := http.NewRequestWithContext(WithIdempotent(ctx), http.MethodPost,
 		frontierHost.ResolveReference(&url.URL{Path: CheckAccessPath}).String(),
 		bytes.NewBuffer(requestBodyBytes),
 	)
 	if err != nil {
 		return false, err
 	}
-	checkAccessRequest.Header = headers
+	checkAccessRequest.Header = headers.Clone()
+	InjectTraceContext(ctx, checkAccessRequest.Header)
+	logger := LoggerFromContext(ctx).With(
+		slog.String("resource", resourceID),
+		slog.String("permission", permission),
+	)
 	resp, err := client.Do(checkAccessRequest)
 	if err != nil {
-		return false, err
+		logger.DebugContext(ctx, "frontier check access call failed", slog.Any("error", err))
+		return false, fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
 	}
 	defer resp.Body.Close()
 
 	// check if action allowed
+	if resp.StatusCode >= http.StatusInternalServerError {
+		logger.DebugContext(ctx, "frontier check access returned server error", slog.Int("status", resp.StatusCode))
+		return false, fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
+		logger.DebugContext(ctx, "frontier check access rejected", slog.Int("status", resp.StatusCode))
 		return false, nil
 	}
 	checkRequestResponse := &frontierv1beta1.CheckResourcePermissionResponse{}
@@ -0,0 +1,254 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Environment variables read by LoadConfig
+const (
+	EnvRESTEndpoint          = "FRONTIER_REST_ENDPOINT"
+	EnvGRPCEndpoint          = "FRONTIER_GRPC_ENDPOINT"
+	EnvGRPCInsecure          = "FRONTIER_GRPC_INSECURE"
+	EnvCACertFile            = "FRONTIER_CA_CERT_FILE"
+	EnvCertFile              = "FRONTIER_CERT_FILE"
+	EnvKeyFile               = "FRONTIER_KEY_FILE"
+	EnvCertReloadInterval    = "FRONTIER_CERT_RELOAD_INTERVAL"
+	EnvCallTimeout           = "FRONTIER_CALL_TIMEOUT"
+	EnvDialTimeout           = "FRONTIER_DIAL_TIMEOUT"
+	EnvJWKSFile              = "FRONTIER_JWKS_FILE"
+	EnvJWKSMinRefresh        = "FRONTIER_JWKS_MIN_REFRESH_INTERVAL"
+	EnvJWKSMaxRefresh        = "FRONTIER_JWKS_MAX_REFRESH_INTERVAL"
+	EnvJWKSUnknownKeyRefresh = "FRONTIER_JWKS_UNKNOWN_KEY_INTERVAL"
+	EnvPolicyFile            = "FRONTIER_POLICY_FILE"
+	EnvCredentialsFile       = "FRONTIER_CREDENTIALS_FILE"
+)
+
+var ErrInvalidConfig = errors.New("invalid frontier config")
+
+// Config is the configuration shared by middleware and client, load it
+// with LoadConfig or fill it in code and call Validate
+type Config struct {
+	// RESTEndpoint is url of frontier http api, for e.g. http://localhost:7400
+	RESTEndpoint string `yaml:"rest_endpoint"`
+	// GRPCEndpoint is host:port of frontier grpc api, for e.g. localhost:7401
+	GRPCEndpoint string `yaml:"grpc_endpoint"`
+	// GRPCInsecure dials grpc over plaintext
+	GRPCInsecure bool `yaml:"grpc_insecure"`
+	// CACertFile is used to verify frontier grpc server certificate,
+	// system cert pool is used if empty
+	CACertFile string `yaml:"ca_cert_file"`
+	// CertFile and KeyFile are the client certificate and key presented
+	// when frontier requires mTLS, both or neither must be set
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// CertReloadInterval re-reads certificate files at most once per
+	// interval to pick up rotated certificates, zero disables it
+	CertReloadInterval time.Duration `yaml:"cert_reload_interval"`
+
+	// CallTimeout bounds every call made to frontier, zero disables it
+	CallTimeout time.Duration `yaml:"call_timeout"`
+	// DialTimeout bounds establishing the grpc connection
+	DialTimeout time.Duration `yaml:"dial_timeout"`
+
+	JWKS JWKSConfig `yaml:"jwks"`
+
+	// PolicyFile maps routes to frontier permissions, see
+	// middleware.LoadPolicyFile for the format
+	PolicyFile string `yaml:"policy_file"`
+	// CredentialsFile is a service user key credential in protojson,
+	// as returned by frontier when a key is created
+	CredentialsFile string `yaml:"credentials_file"`
+}
+
+type JWKSConfig struct {
+	// File loads keys from a local jwks file instead of frontier,
+	// it is checked for changes every DefaultWatchInterval
+	File string `yaml:"file"`
+	// MinRefreshInterval, MaxRefreshInterval and UnknownKeyInterval
+	// as in JWKSRefreshPolicy
+	MinRefreshInterval time.Duration `yaml:"min_refresh_interval"`
+	MaxRefreshInterval time.Duration `yaml:"max_refresh_interval"`
+	UnknownKeyInterval time.Duration `yaml:"unknown_key_interval"`
+}
+
+// RefreshPolicy returns jwks refresh policy of config
+func (c JWKSConfig) RefreshPolicy() JWKSRefreshPolicy {
+	return JWKSRefreshPolicy{
+		MinInterval:        c.MinRefreshInterval,
+		MaxInterval:        c.MaxRefreshInterval,
+		UnknownKeyInterval: c.UnknownKeyInterval,
+	}
+}
+
+// DefaultConfig returns config with defaults used when a value is not set
+func DefaultConfig() Config {
+	return Config{
+		DialTimeout: time.Second * 5,
+		JWKS: JWKSConfig{
+			MinRefreshInterval: DefaultJWKSRefreshPolicy.MinInterval,
+			MaxRefreshInterval: DefaultJWKSRefreshPolicy.MaxInterval,
+			UnknownKeyInterval: DefaultJWKSRefreshPolicy.UnknownKeyInterval,
+		},
+	}
+}
+
+// LoadConfig builds config from defaults, overridden by yaml file at path
+// if not empty, overridden by environment variables. Returned config is
+// validated.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("%w: failed to read %s: %w", ErrInvalidConfig, path, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(raw))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("%w: failed to parse %s: %w", ErrInvalidConfig, path, err)
+		}
+	}
+	if err := cfg.loadEnv(); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadEnv() error {
+	var errs []error
+	str := func(name string, dst *string) {
+		if val, ok := os.LookupEnv(name); ok {
+			*dst = strings.TrimSpace(val)
+		}
+	}
+	duration := func(name string, dst *time.Duration) {
+		if val, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(val))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a duration, e.g. 5s", name, val))
+				return
+			}
+			*dst = d
+		}
+	}
+	boolean := func(name string, dst *bool) {
+		if val, ok := os.LookupEnv(name); ok {
+			b, err := strconv.ParseBool(strings.TrimSpace(val))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %q is not a boolean", name, val))
+				return
+			}
+			*dst = b
+		}
+	}
+
+	str(EnvRESTEndpoint, &c.RESTEndpoint)
+	str(EnvGRPCEndpoint, &c.GRPCEndpoint)
+	boolean(EnvGRPCInsecure, &c.GRPCInsecure)
+	str(EnvCACertFile, &c.CACertFile)
+	str(EnvCertFile, &c.CertFile)
+	str(EnvKeyFile, &c.KeyFile)
+	duration(EnvCertReloadInterval, &c.CertReloadInterval)
+	duration(EnvCallTimeout, &c.CallTimeout)
+	duration(EnvDialTimeout, &c.DialTimeout)
+	str(EnvJWKSFile, &c.JWKS.File)
+	duration(EnvJWKSMinRefresh, &c.JWKS.MinRefreshInterval)
+	duration(EnvJWKSMaxRefresh, &c.JWKS.MaxRefreshInterval)
+	duration(EnvJWKSUnknownKeyRefresh, &c.JWKS.UnknownKeyInterval)
+	str(EnvPolicyFile, &c.PolicyFile)
+	str(EnvCredentialsFile, &c.CredentialsFile)
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+// Validate reports all problems of config at once. Endpoints are optional
+// here, consumers check the ones they need are set.
+func (c Config) Validate() error {
+	var errs []error
+	if c.RESTEndpoint != "" {
+		if _, err := c.RESTURL(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.GRPCEndpoint != "" {
+		if _, _, err := net.SplitHostPort(c.GRPCEndpoint); err != nil {
+			errs = append(errs, fmt.Errorf("grpc_endpoint: %q must be in the form host:port", c.GRPCEndpoint))
+		}
+	}
+	for _, field := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"call_timeout", c.CallTimeout},
+		{"dial_timeout", c.DialTimeout},
+		{"cert_reload_interval", c.CertReloadInterval},
+		{"jwks.min_refresh_interval", c.JWKS.MinRefreshInterval},
+		{"jwks.max_refresh_interval", c.JWKS.MaxRefreshInterval},
+		{"jwks.unknown_key_interval", c.JWKS.UnknownKeyInterval},
+	} {
+		if field.value < 0 {
+			errs = append(errs, fmt.Errorf("%s: must not be negative, got %s", field.name, field.value))
+		}
+	}
+	if c.JWKS.MaxRefreshInterval > 0 && c.JWKS.MaxRefreshInterval < c.JWKS.MinRefreshInterval {
+		errs = append(errs, fmt.Errorf("jwks.max_refresh_interval: %s is less than jwks.min_refresh_interval %s",
+			c.JWKS.MaxRefreshInterval, c.JWKS.MinRefreshInterval))
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		errs = append(errs, errors.New("cert_file, key_file: both must be set for mTLS"))
+	}
+	for _, field := range []struct {
+		name string
+		path string
+	}{
+		{"ca_cert_file", c.CACertFile},
+		{"cert_file", c.CertFile},
+		{"key_file", c.KeyFile},
+		{"jwks.file", c.JWKS.File},
+		{"policy_file", c.PolicyFile},
+		{"credentials_file", c.CredentialsFile},
+	} {
+		if field.path == "" {
+			continue
+		}
+		if info, err := os.Stat(field.path); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", field.name, err))
+		} else if info.IsDir() {
+			errs = append(errs, fmt.Errorf("%s: %s is a directory", field.name, field.path))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+// RESTURL parses RESTEndpoint, nil if not set
+func (c Config) RESTURL() (*url.URL, error) {
+	if c.RESTEndpoint == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(c.RESTEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("rest_endpoint: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("rest_endpoint: %q must be an absolute http(s) url, e.g. http://localhost:7400", c.RESTEndpoint)
+	}
+	return u, nil
+}
@@ -0,0 +1,116 @@
+package pkg_test
+
+import (
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "frontier.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, `
+rest_endpoint: http://file:7400
+grpc_endpoint: file:7401
+call_timeout: 2s
+jwks:
+  min_refresh_interval: 1m
+`)
+	t.Setenv(pkg.EnvGRPCEndpoint, " env:7401 ")
+	t.Setenv(pkg.EnvGRPCInsecure, "true")
+	t.Setenv(pkg.EnvCallTimeout, "3s")
+
+	cfg, err := pkg.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	defaults := pkg.DefaultConfig()
+	for _, check := range []struct {
+		name      string
+		got, want any
+	}{
+		{"rest_endpoint from file", cfg.RESTEndpoint, "http://file:7400"},
+		{"grpc_endpoint from env over file", cfg.GRPCEndpoint, "env:7401"},
+		{"grpc_insecure from env", cfg.GRPCInsecure, true},
+		{"call_timeout from env over file", cfg.CallTimeout, 3 * time.Second},
+		{"jwks.min_refresh_interval from file", cfg.JWKS.MinRefreshInterval, time.Minute},
+		{"jwks.max_refresh_interval default", cfg.JWKS.MaxRefreshInterval, defaults.JWKS.MaxRefreshInterval},
+		{"dial_timeout default", cfg.DialTimeout, defaults.DialTimeout},
+	} {
+		if check.got != check.want {
+			t.Errorf("%s = %v, want %v", check.name, check.got, check.want)
+		}
+	}
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	t.Setenv(pkg.EnvRESTEndpoint, "http://env:7400")
+	cfg, err := pkg.LoadConfig("")
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+	if cfg.RESTEndpoint != "http://env:7400" || cfg.DialTimeout != pkg.DefaultConfig().DialTimeout {
+		t.Errorf("LoadConfig() = %+v, want defaults and env", cfg)
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		env     map[string]string
+		wantErr string
+	}{
+		{name: "unknown field", file: "grpc_endpoit: localhost:7401", wantErr: "grpc_endpoit"},
+		{name: "bad duration in file", file: "call_timeout: soon", wantErr: "soon"},
+		{name: "bad duration in env", env: map[string]string{pkg.EnvDialTimeout: "5"}, wantErr: pkg.EnvDialTimeout},
+		{name: "bad boolean in env", env: map[string]string{pkg.EnvGRPCInsecure: "maybe"}, wantErr: pkg.EnvGRPCInsecure},
+		{name: "relative rest endpoint", env: map[string]string{pkg.EnvRESTEndpoint: "localhost:7400"}, wantErr: "rest_endpoint"},
+		{name: "grpc endpoint without port", file: "grpc_endpoint: localhost", wantErr: "grpc_endpoint"},
+		{name: "negative timeout", file: "call_timeout: -1s", wantErr: "call_timeout"},
+		{name: "max refresh below min", file: "jwks: {min_refresh_interval: 1h, max_refresh_interval: 1m}", wantErr: "jwks.max_refresh_interval"},
+		{name: "missing policy file", env: map[string]string{pkg.EnvPolicyFile: "/does/not/exist.yaml"}, wantErr: "policy_file"},
+		{name: "cert without key", env: map[string]string{pkg.EnvCertFile: os.Args[0]}, wantErr: "key_file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = writeConfigFile(t, tt.file)
+			}
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			_, err := pkg.LoadConfig(path)
+			if !errors.Is(err, pkg.ErrInvalidConfig) {
+				t.Fatalf("LoadConfig() error = %v, want ErrInvalidConfig", err)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want it to mention %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestConfigValidateReportsAllProblems(t *testing.T) {
+	err := pkg.Config{GRPCEndpoint: "localhost", CallTimeout: -time.Second, JWKS: pkg.JWKSConfig{File: t.TempDir()}}.Validate()
+	if !errors.Is(err, pkg.ErrInvalidConfig) {
+		t.Fatalf("Validate() error = %v, want ErrInvalidConfig", err)
+	}
+	for _, field := range []string{"grpc_endpoint", "call_timeout", "jwks.file"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Validate() error = %v, want it to mention %s", err, field)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCredentialSecretKey is the key holding a protojson credential
+	// in a mounted secret directory
+	DefaultCredentialSecretKey = "credential.json"
+
+	// secret keys used when credential fields are stored separately
+	secretKeyPrincipalID = "principal_id"
+	secretKeyKeyID       = "kid"
+	secretKeyPrivateKey  = "private_key"
+)
+
+var (
+	ErrInvalidCredential  = errors.New("invalid service user credential")
+	ErrReadOnlyCredential = errors.New("credential provider can't store credentials")
+)
+
+// CredentialProvider supplies the current service user key credential,
+// implementations may reload it when the key is rotated
+type CredentialProvider interface {
+	Credential(ctx context.Context) (*frontierv1beta1.KeyCredential, error)
+}
+
+// CredentialStore is a CredentialProvider able to persist a new credential,
+// used to hand a rotated key over to everything reading from it
+type CredentialStore interface {
+	CredentialProvider
+	Store(ctx context.Context, credential *frontierv1beta1.KeyCredential) error
+}
+
+// LoadKeyCredential parses a service user key credential in protojson, as
+// returned by frontier when a key is created. Value can also be base64
+// encoded protojson, as commonly stored in environment variables.
+func LoadKeyCredential(raw []byte) (*frontierv1beta1.KeyCredential, error) {
+	decoded, err := decodeMaybeBase64(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	credential := &frontierv1beta1.KeyCredential{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(decoded, credential); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	if err := ValidateKeyCredential(credential); err != nil {
+		return nil, err
+	}
+	return credential, nil
+}
+
+// LoadKeyCredentialFile reads a credential from file, see LoadKeyCredential
+func LoadKeyCredentialFile(path string) (*frontierv1beta1.KeyCredential, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := LoadKeyCredential(raw)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return credential, nil
+}
+
+// LoadKeyCredentialEnv reads a credential from environment variable name,
+// see LoadKeyCredential
+func LoadKeyCredentialEnv(name string) (*frontierv1beta1.KeyCredential, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok || strings.TrimSpace(value) == "" {
+		return nil, fmt.Errorf("%w: %s is not set", ErrInvalidCredential, name)
+	}
+	credential, err := LoadKeyCredential([]byte(value))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return credential, nil
+}
+
+// LoadSecretCredential parses a service user secret credential in protojson,
+// as returned by frontier when a secret is created, or base64 encoded
+// protojson. Its id is the client id of the client credentials grant.
+func LoadSecretCredential(raw []byte) (*frontierv1beta1.SecretCredential, error) {
+	decoded, err := decodeMaybeBase64(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	credential := &frontierv1beta1.SecretCredential{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(decoded, credential); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	var missing []string
+	if credential.GetId() == "" {
+		missing = append(missing, "id")
+	}
+	if credential.GetSecret() == "" {
+		missing = append(missing, "secret")
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: missing %s", ErrInvalidCredential, strings.Join(missing, ", "))
+	}
+	return credential, nil
+}
+
+// ValidateKeyCredential checks fields required to mint tokens are set
+func ValidateKeyCredential(credential *frontierv1beta1.KeyCredential) error {
+	var missing []string
+	if credential.GetPrincipalId() == "" {
+		missing = append(missing, "principal_id")
+	}
+	if credential.GetKid() == "" {
+		missing = append(missing, "kid")
+	}
+	if credential.GetPrivateKey() == "" {
+		missing = append(missing, "private_key")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: missing %s", ErrInvalidCredential, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// StaticCredentialProvider keeps a credential in memory, it only changes
+// when a new one is stored
+type StaticCredentialProvider struct {
+	mu         sync.RWMutex
+	credential *frontierv1beta1.KeyCredential
+}
+
+func NewStaticCredentialProvider(credential *frontierv1beta1.KeyCredential) (*StaticCredentialProvider, error) {
+	if err := ValidateKeyCredential(credential); err != nil {
+		return nil, err
+	}
+	return &StaticCredentialProvider{credential: credential}, nil
+}
+
+func (p *StaticCredentialProvider) Credential(context.Context) (*frontierv1beta1.KeyCredential, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.credential, nil
+}
+
+// Store replaces the credential
+func (p *StaticCredentialProvider) Store(_ context.Context, credential *frontierv1beta1.KeyCredential) error {
+	if err := ValidateKeyCredential(credential); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.credential = credential
+	return nil
+}
+
+// ReloadingCredentialProvider serves a credential loaded from disk and
+// reloads it when the watched file changes, a reload that fails keeps the
+// previous credential. Create one with NewFileCredentialProvider or
+// NewSecretDirCredentialProvider.
+type ReloadingCredentialProvider struct {
+	load func() (*frontierv1beta1.KeyCredential, error)
+	save func(*frontierv1beta1.KeyCredential) error
+
+	mu         sync.RWMutex
+	credential *frontierv1beta1.KeyCredential
+	loaded     time.Time
+	lastErr    error
+	listeners  []func(*frontierv1beta1.KeyCredential)
+}
+
+// NewFileCredentialProvider loads credential from file at path, it is
+// checked for changes every interval until ctx is done. A non-positive
+// interval uses DefaultWatchInterval. Stored credentials are written to
+// the same file.
+func NewFileCredentialProvider(ctx context.Context, path string, interval time.Duration) (*ReloadingCredentialProvider, error) {
+	p, err := newReloadingCredentialProvider(ctx, path, interval, func() (*frontierv1beta1.KeyCredential, error) {
+		return LoadKeyCredentialFile(path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.save = func(credential *frontierv1beta1.KeyCredential) error {
+		return writeKeyCredentialFile(path, credential)
+	}
+	return p, nil
+}
+
+// NewSecretDirCredentialProvider loads credential from a kubernetes secret
+// mounted at dir. The secret either holds the protojson credential under
+// DefaultCredentialSecretKey, or its fields under principal_id, kid and
+// private_key keys. Kubernetes updates mounted secrets by swapping a
+// symlink, which is picked up on the next check. Mounted secrets are read
+// only, storing a credential returns ErrReadOnlyCredential.
+func NewSecretDirCredentialProvider(ctx context.Context, dir string, interval time.Duration) (*ReloadingCredentialProvider, error) {
+	watched := filepath.Join(dir, DefaultCredentialSecretKey)
+	load := func() (*frontierv1beta1.KeyCredential, error) {
+		return LoadKeyCredentialFile(watched)
+	}
+	if _, err := os.Stat(watched); errors.Is(err, os.ErrNotExist) {
+		watched = filepath.Join(dir, secretKeyPrivateKey)
+		load = func() (*frontierv1beta1.KeyCredential, error) {
+			return loadSecretDirFields(dir)
+		}
+	}
+	return newReloadingCredentialProvider(ctx, watched, interval, load)
+}
+
+func newReloadingCredentialProvider(ctx context.Context, watched string, interval time.Duration,
+	load func() (*frontierv1beta1.KeyCredential, error)) (*ReloadingCredentialProvider, error) {
+	credential, err := load()
+	if err != nil {
+		return nil, err
+	}
+	p := &ReloadingCredentialProvider{
+		load:       load,
+		credential: credential,
+		loaded:     time.Now(),
+	}
+	watchFile(ctx, watched, interval, func() {
+		if err := p.Reload(); err != nil {
+			LoggerFromContext(ctx).WarnContext(ctx, "failed to reload service user credential",
+				slog.String("path", watched), slog.Any("error", err))
+		}
+	})
+	return p, nil
+}
+
+func (p *ReloadingCredentialProvider) Credential(context.Context) (*frontierv1beta1.KeyCredential, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.credential, nil
+}
+
+// Reload loads the credential again, listeners are notified if its key changed
+func (p *ReloadingCredentialProvider) Reload() error {
+	credential, err := p.load()
+
+	p.mu.Lock()
+	if err != nil {
+		p.lastErr = err
+		p.mu.Unlock()
+		return err
+	}
+	rotated := credential.GetKid() != p.credential.GetKid()
+	p.credential, p.loaded, p.lastErr = credential, time.Now(), nil
+	listeners := append(([]func(*frontierv1beta1.KeyCredential))(nil), p.listeners...)
+	p.mu.Unlock()
+
+	if rotated {
+		for _, fn := range listeners {
+			fn(credential)
+		}
+	}
+	return nil
+}
+
+// Store persists credential and reloads it, listeners are notified if its
+// key changed
+func (p *ReloadingCredentialProvider) Store(_ context.Context, credential *frontierv1beta1.KeyCredential) error {
+	if p.save == nil {
+		return ErrReadOnlyCredential
+	}
+	if err := ValidateKeyCredential(credential); err != nil {
+		return err
+	}
+	if err := p.save(credential); err != nil {
+		return err
+	}
+	return p.Reload()
+}
+
+// OnRotate registers fn to be called with the new credential whenever a
+// reload finds a different key
+func (p *ReloadingCredentialProvider) OnRotate(fn func(*frontierv1beta1.KeyCredential)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, fn)
+}
+
+// LastReload returns when credential was last loaded and the error of the
+// last failed reload since
+func (p *ReloadingCredentialProvider) LastReload() (time.Time, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.loaded, p.lastErr
+}
+
+// writeKeyCredentialFile replaces file at path with credential in protojson,
+// written to a temporary file first so readers never see a partial one
+func writeKeyCredentialFile(path string, credential *frontierv1beta1.KeyCredential) error {
+	raw, err := protojson.Marshal(credential)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func loadSecretDirFields(dir string) (*frontierv1beta1.KeyCredential, error) {
+	read := func(key string) (string, error) {
+		raw, err := os.ReadFile(filepath.Join(dir, key))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		return strings.TrimSpace(string(raw)), nil
+	}
+	credential := &frontierv1beta1.KeyCredential{}
+	var err error
+	if credential.PrincipalId, err = read(secretKeyPrincipalID); err != nil {
+		return nil, err
+	}
+	if credential.Kid, err = read(secretKeyKeyID); err != nil {
+		return nil, err
+	}
+	if credential.PrivateKey, err = read(secretKeyPrivateKey); err != nil {
+		return nil, err
+	}
+	if err := ValidateKeyCredential(credential); err != nil {
+		return nil, fmt.Errorf("%s: %w", dir, err)
+	}
+	return credential, nil
+}
@@ -9,4 +9,11 @@ var (
 	ErrJWKsFetch      = errors.New("failed to fetch jwks")
 	ErrInvalidSession = errors.New("invalid session, failed to fetch user")
 	ErrInternalServer = errors.New("internal server error")
+
+	ErrCircuitOpen         = errors.New("circuit breaker open, frontier calls suspended")
+	ErrFrontierUnavailable = errors.New("frontier unavailable")
+	ErrUnexpectedResponse  = errors.New("unexpected response from frontier")
+	ErrInvalidTokenOptions = errors.New("invalid token options")
+	ErrInvalidGrant        = errors.New("frontier rejected the token grant")
+	ErrLoginRejected       = errors.New("frontier rejected the login")
 )
@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Ping checks frontier api is reachable at frontierHost. The current user
+// is requested without credentials, frontier is expected to reject it as
+// unauthenticated; any other status means host points to something else.
+func Ping(ctx context.Context, client HTTPClient, frontierHost *url.URL) (err error) {
+	ctx, span := StartSpan(ctx, "frontier.Ping")
+	defer func() { EndSpan(span, err) }()
+
+	if frontierHost == nil {
+		return ErrMissingHost
+	}
+	pingRequest, err := http.NewRequestWithContext(WithIdempotent(ctx), http.MethodGet,
+		frontierHost.ResolveReference(&url.URL{Path: CurrentUserProfilePath}).String(), nil)
+	if err != nil {
+		return err
+	}
+	InjectTraceContext(ctx, pingRequest.Header)
+	resp, err := client.Do(pingRequest)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+	default:
+		return fmt.Errorf("%w: %s from %s", ErrUnexpectedResponse, resp.Status, RedactURL(pingRequest.URL.String()))
+	}
+}
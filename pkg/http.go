@@ -3,7 +3,12 @@ package pkg
 import (
 	"context"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
@@ -11,6 +16,7 @@ const (
 	CheckAccessPath          = "/v1beta1/check"
 	ServiceUserPublicKeyPath = "/v1beta1/serviceusers/%s/keys/%s"
 	JWKSAccessPath           = "/.well-known/jwks.json"
+	AuthTokenPath            = "/v1beta1/auth/token"
 )
 
 type HTTPClient interface {
@@ -28,26 +34,241 @@ type FrontierJWKCache interface {
 	Register(option ...jwk.RegisterOption) error
 }
 
+// CachedJWKSetGetter is implemented by caches able to report whether
+// a lookup was served from memory or required fetching the set
+type CachedJWKSetGetter interface {
+	GetCached(ctx context.Context) (set jwk.Set, cacheHit bool, err error)
+}
+
+// KeyIDGetter is implemented by caches able to refresh the set when it
+// doesn't contain the key a token was signed with, e.g. after frontier
+// rotated its signing key
+type KeyIDGetter interface {
+	GetForKeyID(ctx context.Context, kid string) (jwk.Set, error)
+}
+
+// JWKSStatus is the health of a jwks cache
+type JWKSStatus struct {
+	// LastFetch is when keys were last fetched successfully
+	LastFetch time.Time
+	// LastError is the error of the last failed fetch, cleared
+	// on the next successful one
+	LastError   error
+	LastErrorAt time.Time
+	Fetches     int64
+}
+
+// Ready reports if keys were fetched and the last fetch succeeded
+func (s JWKSStatus) Ready() bool {
+	return !s.LastFetch.IsZero() && s.LastError == nil
+}
+
+// JWKSStatusReporter is implemented by caches exposing their JWKSStatus
+type JWKSStatusReporter interface {
+	Status() JWKSStatus
+}
+
+// JWKSRefreshPolicy controls how often a JWKCache fetches keys
+type JWKSRefreshPolicy struct {
+	// MinInterval is the minimum time between scheduled refreshes,
+	// longer cache headers sent by frontier are honored
+	MinInterval time.Duration
+	// MaxInterval forces a refresh at least this often regardless of
+	// cache headers, zero disables it
+	MaxInterval time.Duration
+	// UnknownKeyInterval is the minimum time between refreshes forced by
+	// tokens signed with a kid missing from the set, zero disables them
+	UnknownKeyInterval time.Duration
+}
+
+var DefaultJWKSRefreshPolicy = JWKSRefreshPolicy{
+	MinInterval:        time.Minute * 15,
+	UnknownKeyInterval: time.Minute,
+}
+
 type JWKCache struct {
 	*jwk.Cache
-	url string
+	ctx     context.Context
+	url     string
+	fetches atomic.Int64
+	policy  JWKSRefreshPolicy
+
+	// forceMu serializes forced refreshes so concurrent requests carrying
+	// the same unknown kid cause a single fetch
+	forceMu    sync.Mutex
+	lastForced time.Time
+
+	statusMu sync.RWMutex
+	status   JWKSStatus
 }
 
+// NewJWKCacheForURL creates a cache using DefaultJWKSRefreshPolicy. Background
+// refresh errors are recorded in Status unless an error sink is passed
+// in options. Fetches starting or stopping to fail are logged through
+// the logger of ctx.
 func NewJWKCacheForURL(url string, ctx context.Context, options ...jwk.CacheOption) *JWKCache {
-	return &JWKCache{
-		Cache: jwk.NewCache(ctx, options...),
-		url:   url,
+	c := &JWKCache{
+		ctx:    ctx,
+		url:    url,
+		policy: DefaultJWKSRefreshPolicy,
 	}
+	sink := jwk.WithErrSink(errSinkFunc(c.recordError))
+	c.Cache = jwk.NewCache(ctx, append([]jwk.CacheOption{sink}, options...)...)
+	return c
+}
+
+// SetRefreshPolicy changes refresh intervals, it must be called before Register
+func (c *JWKCache) SetRefreshPolicy(policy JWKSRefreshPolicy) {
+	c.policy = policy
 }
 
 func (c *JWKCache) Get(ctx context.Context) (jwk.Set, error) {
-	return c.Cache.Get(ctx, c.url)
+	set, err := c.Cache.Get(ctx, c.url)
+	if err != nil && ctx.Err() == nil {
+		// cancelled callers don't make the cache unhealthy
+		c.recordError(err)
+	}
+	return set, err
 }
 
 func (c *JWKCache) Refresh(ctx context.Context) (jwk.Set, error) {
-	return c.Cache.Refresh(ctx, c.url)
+	set, err := c.Cache.Refresh(ctx, c.url)
+	if err != nil && ctx.Err() == nil {
+		c.recordError(err)
+	}
+	return set, err
+}
+
+// GetCached returns jwks set and whether it was served without a fetch
+func (c *JWKCache) GetCached(ctx context.Context) (jwk.Set, bool, error) {
+	before := c.fetches.Load()
+	set, err := c.Get(ctx)
+	return set, err == nil && c.fetches.Load() == before, err
+}
+
+// GetForKeyID returns jwks set, refreshing it first if it doesn't contain
+// kid. Forced refreshes happen at most once per policy UnknownKeyInterval,
+// so tokens with made up kids can't be used to hammer frontier.
+func (c *JWKCache) GetForKeyID(ctx context.Context, kid string) (jwk.Set, error) {
+	set, err := c.Get(ctx)
+	if err != nil || kid == "" || c.policy.UnknownKeyInterval <= 0 {
+		return set, err
+	}
+	if _, ok := set.LookupKeyID(kid); ok {
+		return set, nil
+	}
+
+	c.forceMu.Lock()
+	defer c.forceMu.Unlock()
+	// another request may have refreshed while we waited
+	if set, err = c.Get(ctx); err != nil {
+		return nil, err
+	}
+	if _, ok := set.LookupKeyID(kid); ok || time.Since(c.lastForced) < c.policy.UnknownKeyInterval {
+		return set, nil
+	}
+	c.lastForced = time.Now()
+	LoggerFromContext(ctx).DebugContext(ctx, "refreshing jwks for unknown key", "kid", kid)
+	refreshed, err := c.Refresh(ctx)
+	if err != nil {
+		// keep serving known keys, the token will fail verification
+		return set, nil
+	}
+	return refreshed, nil
+}
+
+// Status returns last fetch time and error
+func (c *JWKCache) Status() JWKSStatus {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+	status := c.status
+	status.Fetches = c.fetches.Load()
+	return status
+}
+
+func (c *JWKCache) recordFetch() {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.status.LastError != nil {
+		LoggerFromContext(c.ctx).InfoContext(c.ctx, "jwks fetch recovered", "url", RedactURL(c.url))
+	}
+	c.status.LastFetch = time.Now()
+	c.status.LastError = nil
+}
+
+// recordError logs only the first of consecutive errors, a failing
+// frontier would flood logs otherwise
+func (c *JWKCache) recordError(err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+	if c.status.LastError == nil {
+		LoggerFromContext(c.ctx).WarnContext(c.ctx, "jwks fetch failed", "url", RedactURL(c.url), "error", err)
+	}
+	c.status.LastError = err
+	c.status.LastErrorAt = time.Now()
 }
 
+// Fetches returns number of times the jwks set was fetched from remote
+func (c *JWKCache) Fetches() int64 {
+	return c.fetches.Load()
+}
+
+// Register registers the url with cache, a post fetcher passed in options
+// replaces the one used for counting fetches. Refresh intervals passed in
+// options take precedence over the refresh policy.
 func (c *JWKCache) Register(option ...jwk.RegisterOption) error {
-	return c.Cache.Register(c.url, option...)
+	countFetches := jwk.WithPostFetcher(jwk.PostFetchFunc(func(_ string, set jwk.Set) (jwk.Set, error) {
+		c.fetches.Add(1)
+		c.recordFetch()
+		return set, nil
+	}))
+	defaults := []jwk.RegisterOption{countFetches}
+	if c.policy.MinInterval > 0 {
+		defaults = append(defaults, jwk.WithMinRefreshInterval(c.policy.MinInterval))
+	}
+	if err := c.Cache.Register(c.url, append(defaults, option...)...); err != nil {
+		return err
+	}
+	if c.policy.MaxInterval > 0 {
+		go c.refreshEvery(c.policy.MaxInterval)
+	}
+	return nil
+}
+
+// refreshEvery refreshes keys every interval until cache context is done
+func (c *JWKCache) refreshEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			// failures are logged by recordError
+			_, _ = c.Refresh(c.ctx)
+		}
+	}
+}
+
+// FrontierTokenKeyID returns kid from jwt header without verifying the
+// token, empty if token is not issued by frontier e.g. service user tokens
+func FrontierTokenKeyID(token string) string {
+	insecureToken, err := jwt.ParseInsecure([]byte(token))
+	if err != nil {
+		return ""
+	}
+	if tokenType, ok := insecureToken.Get(generatedClaimKey); !ok || tokenType != generatedClaimValue {
+		return ""
+	}
+	msg, err := jws.Parse([]byte(token))
+	if err != nil || len(msg.Signatures()) == 0 {
+		return ""
+	}
+	return msg.Signatures()[0].ProtectedHeaders().KeyID()
+}
+
+type errSinkFunc func(err error)
+
+func (f errSinkFunc) Error(err error) {
+	f(err)
 }
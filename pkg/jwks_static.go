@@ -0,0 +1,170 @@
+package pkg
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrEmptyJWKS = errors.New("jwks source is empty")
+
+// StaticJWKCache is a FrontierJWKCache serving keys loaded from a local
+// source instead of frontier, for air-gapped services and tests.
+// Refresh reloads the source, which is a no-op for in-memory sets.
+type StaticJWKCache struct {
+	mu     sync.RWMutex
+	set    jwk.Set
+	load   func() ([]byte, error)
+	loaded time.Time
+
+	lastErr   error
+	lastErrAt time.Time
+}
+
+// NewStaticJWKCache serves set as is, use Validate to reject an empty set
+func NewStaticJWKCache(set jwk.Set) *StaticJWKCache {
+	return &StaticJWKCache{set: set, loaded: time.Now()}
+}
+
+// NewJWKCacheFromBytes parses a json encoded jwks, useful with go:embed
+func NewJWKCacheFromBytes(raw []byte) (*StaticJWKCache, error) {
+	return newStaticJWKCache(func() ([]byte, error) {
+		return raw, nil
+	})
+}
+
+// NewJWKCacheFromEnv parses jwks from environment variable name,
+// value can be raw json or base64 encoded json
+func NewJWKCacheFromEnv(name string) (*StaticJWKCache, error) {
+	return newStaticJWKCache(func() ([]byte, error) {
+		return decodeMaybeBase64(os.Getenv(name))
+	})
+}
+
+// NewJWKCacheFromFile parses jwks from file at path and reloads it when the
+// file changes until ctx is done. A reload that fails to parse keeps the
+// previous keys. A non-positive interval uses DefaultWatchInterval.
+func NewJWKCacheFromFile(ctx context.Context, path string, interval time.Duration) (*StaticJWKCache, error) {
+	c, err := newStaticJWKCache(func() ([]byte, error) {
+		return os.ReadFile(path)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load jwks from %s: %w", path, err)
+	}
+	watchFile(ctx, path, interval, func() {
+		if _, err := c.Refresh(ctx); err != nil {
+			LoggerFromContext(ctx).WarnContext(ctx, "failed to reload jwks file",
+				"path", path, "error", err)
+		}
+	})
+	return c, nil
+}
+
+func newStaticJWKCache(load func() ([]byte, error)) (*StaticJWKCache, error) {
+	c := &StaticJWKCache{load: load}
+	if _, err := c.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns ErrEmptyJWKS if the cache holds no keys
+func (c *StaticJWKCache) Validate() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.set == nil || c.set.Len() == 0 {
+		return ErrEmptyJWKS
+	}
+	return nil
+}
+
+func (c *StaticJWKCache) Get(_ context.Context) (jwk.Set, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.set, nil
+}
+
+// GetCached always reports a cache hit as keys never leave the process
+func (c *StaticJWKCache) GetCached(ctx context.Context) (jwk.Set, bool, error) {
+	set, err := c.Get(ctx)
+	return set, true, err
+}
+
+func (c *StaticJWKCache) Refresh(ctx context.Context) (jwk.Set, error) {
+	if c.load == nil {
+		return c.Get(ctx)
+	}
+	set, err := c.parse()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		c.lastErr, c.lastErrAt = err, time.Now()
+		return nil, err
+	}
+	c.set = set
+	c.loaded = time.Now()
+	c.lastErr = nil
+	return set, nil
+}
+
+func (c *StaticJWKCache) parse() (jwk.Set, error) {
+	raw, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(strings.TrimSpace(string(raw))) == 0 {
+		return nil, ErrEmptyJWKS
+	}
+	set, err := jwk.Parse(raw)
+	if err != nil {
+		return nil, err
+	}
+	if set.Len() == 0 {
+		return nil, ErrEmptyJWKS
+	}
+	return set, nil
+}
+
+// Register is a no-op as there is no url to fetch from
+func (c *StaticJWKCache) Register(...jwk.RegisterOption) error {
+	return nil
+}
+
+// LoadedAt returns when keys were last loaded
+func (c *StaticJWKCache) LoadedAt() time.Time {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loaded
+}
+
+// Status reports last load time and reload error
+func (c *StaticJWKCache) Status() JWKSStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return JWKSStatus{
+		LastFetch:   c.loaded,
+		LastError:   c.lastErr,
+		LastErrorAt: c.lastErrAt,
+	}
+}
+
+// decodeMaybeBase64 returns value as is if it looks like json,
+// otherwise base64 decodes it
+func decodeMaybeBase64(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.HasPrefix(value, "{") {
+		return []byte(value), nil
+	}
+	decoded, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("value is neither json nor base64: %w", err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,28 @@
+package pkg_test
+
+import (
+	"errors"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/raystack/frontier-go/frontiertest"
+	"github.com/raystack/frontier-go/pkg"
+	"testing"
+)
+
+func TestStaticJWKCacheRejectsEmptySets(t *testing.T) {
+	for _, raw := range []string{"", " ", `{"keys":[]}`} {
+		if _, err := pkg.NewJWKCacheFromBytes([]byte(raw)); !errors.Is(err, pkg.ErrEmptyJWKS) {
+			t.Errorf("NewJWKCacheFromBytes(%q) error = %v, want ErrEmptyJWKS", raw, err)
+		}
+	}
+	for _, set := range []jwk.Set{nil, jwk.NewSet()} {
+		if err := pkg.NewStaticJWKCache(set).Validate(); !errors.Is(err, pkg.ErrEmptyJWKS) {
+			t.Errorf("Validate() of %v error = %v, want ErrEmptyJWKS", set, err)
+		}
+	}
+
+	srv := frontiertest.NewServer()
+	defer srv.Close()
+	if err := pkg.NewStaticJWKCache(srv.PublicKeys()).Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
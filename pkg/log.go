@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+const redacted = "[REDACTED]"
+
+// SensitiveHeaders are masked whenever headers are logged
+var SensitiveHeaders = []string{
+	"Authorization",
+	"Cookie",
+	"Set-Cookie",
+	"Proxy-Authorization",
+	DefaultUserTokenHeader,
+}
+
+type loggerContextKey struct{}
+
+// NopLogger discards all records, used when no logger is configured
+var NopLogger = slog.New(discardHandler{})
+
+// ContextWithLogger attaches logger to ctx, sdk functions called with
+// this ctx log through it. They log details of frontier calls at debug
+// level and return errors, logging failures is left to the caller.
+func ContextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// LoggerFromContext returns logger attached to ctx or NopLogger
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok && logger != nil {
+		return logger
+	}
+	return NopLogger
+}
+
+// RedactToken keeps only a short prefix of token so log lines
+// can be correlated without leaking credentials
+func RedactToken(token string) string {
+	if len(token) <= 8 {
+		return redacted
+	}
+	return token[:4] + "..." + redacted
+}
+
+// RedactHeaders returns a copy of headers safe to log
+func RedactHeaders(headers http.Header) http.Header {
+	safe := headers.Clone()
+	for _, name := range SensitiveHeaders {
+		if values := safe.Values(name); len(values) > 0 {
+			masked := make([]string, len(values))
+			for i := range values {
+				masked[i] = redacted
+			}
+			safe[http.CanonicalHeaderKey(name)] = masked
+		}
+	}
+	return safe
+}
+
+// Secret wraps a string so it is always redacted by slog
+type Secret string
+
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(RedactToken(string(s)))
+}
+
+func (s Secret) String() string {
+	return RedactToken(string(s))
+}
+
+// RedactURL drops query string and user info which may carry credentials
+func RedactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return redacted
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return u.String()
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
@@ -0,0 +1,139 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+)
+
+const (
+	AuthStrategiesPath = "/v1beta1/auth"
+	AuthStartPath      = "/v1beta1/auth/register/%s"
+	AuthCallbackPath   = "/v1beta1/auth/callback"
+	AuthLogoutPath     = "/v1beta1/auth/logout"
+)
+
+// ListAuthStrategies returns login strategies enabled in frontier, e.g. oidc
+// providers like google or mailotp
+func ListAuthStrategies(ctx context.Context, client HTTPClient, frontierHost *url.URL) (strategies []*frontierv1beta1.AuthStrategy, err error) {
+	ctx, span := StartSpan(ctx, "frontier.ListAuthStrategies")
+	defer func() { EndSpan(span, err) }()
+
+	resp := &frontierv1beta1.ListAuthStrategiesResponse{}
+	if _, err := callAuthAPI(WithIdempotent(ctx), client, frontierHost, http.MethodGet, AuthStrategiesPath, nil, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp.GetStrategies(), nil
+}
+
+// StartLogin starts a login with strategy of req. Frontier returns the
+// endpoint to send the browser to and a state to resume the flow at
+// callback, strategies like mailotp have no endpoint and send a code.
+func StartLogin(ctx context.Context, client HTTPClient, frontierHost *url.URL,
+	req *frontierv1beta1.AuthenticateRequest) (resp *frontierv1beta1.AuthenticateResponse, err error) {
+	ctx, span := StartSpan(ctx, "frontier.StartLogin")
+	defer func() { EndSpan(span, err) }()
+
+	resp = &frontierv1beta1.AuthenticateResponse{}
+	path := fmt.Sprintf(AuthStartPath, url.PathEscape(req.GetStrategyName()))
+	if _, err := callAuthAPI(ctx, client, frontierHost, http.MethodPost, path, req, nil, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// FinishLogin completes a login with the code and state received at
+// callback and returns id of the session frontier created, as it is
+// expected in DefaultSessionID cookie
+func FinishLogin(ctx context.Context, client HTTPClient, frontierHost *url.URL,
+	req *frontierv1beta1.AuthCallbackRequest) (sessionID string, err error) {
+	ctx, span := StartSpan(ctx, "frontier.FinishLogin")
+	defer func() { EndSpan(span, err) }()
+
+	httpResp, err := callAuthAPI(ctx, client, frontierHost, http.MethodPost, AuthCallbackPath, req, nil,
+		&frontierv1beta1.AuthCallbackResponse{})
+	if err != nil {
+		return "", err
+	}
+	for _, cookie := range httpResp.Cookies() {
+		if cookie.Name == DefaultSessionID && cookie.Value != "" {
+			return cookie.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no session cookie set by login callback", ErrUnexpectedResponse)
+}
+
+// Logout deletes session sessionID in frontier
+func Logout(ctx context.Context, client HTTPClient, frontierHost *url.URL, sessionID string) (err error) {
+	ctx, span := StartSpan(ctx, "frontier.Logout")
+	defer func() { EndSpan(span, err) }()
+
+	headers := http.Header{}
+	headers.Set("Cookie", (&http.Cookie{Name: DefaultSessionID, Value: sessionID}).String())
+	_, err = callAuthAPI(WithIdempotent(ctx), client, frontierHost, http.MethodGet, AuthLogoutPath, nil, headers,
+		&frontierv1beta1.AuthLogoutResponse{})
+	return err
+}
+
+// callAuthAPI sends body to an authentication endpoint and decodes its
+// response into resp, the http response is returned with body closed
+func callAuthAPI(ctx context.Context, client HTTPClient, frontierHost *url.URL, method, path string,
+	body proto.Message, headers http.Header, resp proto.Message) (*http.Response, error) {
+	if frontierHost == nil {
+		return nil, ErrMissingHost
+	}
+	var reader io.Reader = http.NoBody
+	if body != nil {
+		raw, err := protojson.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(ctx, method,
+		frontierHost.ResolveReference(&url.URL{Path: path}).String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if headers != nil {
+		req.Header = headers.Clone()
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	InjectTraceContext(ctx, req.Header)
+	httpResp, err := client.Do(req)
+	if err != nil {
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier auth call failed",
+			slog.String("path", path), slog.Any("error", err))
+		return nil, fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	defer httpResp.Body.Close()
+
+	raw, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case httpResp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: %s", ErrFrontierUnavailable, httpResp.Status)
+	case httpResp.StatusCode != http.StatusOK:
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier auth call rejected",
+			slog.String("path", path), slog.Int("status", httpResp.StatusCode))
+		return nil, fmt.Errorf("%w: %s", ErrLoginRejected, httpResp.Status)
+	}
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return httpResp, nil
+	}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, resp); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	return httpResp, nil
+}
@@ -0,0 +1,167 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// ResilientHTTPClient wraps a HTTPClient with per call timeouts,
+// retries with exponential backoff and a circuit breaker
+type ResilientHTTPClient struct {
+	client  HTTPClient
+	policy  *RetryPolicy
+	timeout time.Duration
+	breaker *CircuitBreaker
+	budget  *retryBudget
+}
+
+func WithRetryPolicy(policy RetryPolicy) func(*ResilientHTTPClient) {
+	return func(c *ResilientHTTPClient) {
+		c.policy = &policy
+	}
+}
+
+// WithCallTimeout bounds every attempt made to frontier
+func WithCallTimeout(timeout time.Duration) func(*ResilientHTTPClient) {
+	return func(c *ResilientHTTPClient) {
+		c.timeout = timeout
+	}
+}
+
+func WithCircuitBreaker(breaker *CircuitBreaker) func(*ResilientHTTPClient) {
+	return func(c *ResilientHTTPClient) {
+		c.breaker = breaker
+	}
+}
+
+func NewResilientHTTPClient(client HTTPClient, opts ...func(*ResilientHTTPClient)) *ResilientHTTPClient {
+	c := &ResilientHTTPClient{
+		client: client,
+	}
+	for _, o := range opts {
+		o(c)
+	}
+	if c.policy != nil {
+		c.budget = newRetryBudget(c.policy.BudgetRatio, c.policy.BudgetMinRetries)
+	}
+	return c
+}
+
+func (c *ResilientHTTPClient) Get(url string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.Do(req)
+}
+
+func (c *ResilientHTTPClient) Do(r *http.Request) (*http.Response, error) {
+	maxAttempts := 1
+	if c.policy != nil && c.policy.MaxAttempts > 1 && IsIdempotent(r) && (r.Body == nil || r.GetBody != nil) {
+		maxAttempts = c.policy.MaxAttempts
+	}
+	c.budget.deposit()
+
+	var (
+		resp *http.Response
+		err  error
+	)
+	for attempt := 1; ; attempt++ {
+		resp, err = c.attempt(r)
+		if attempt >= maxAttempts || !c.shouldRetry(r, resp, err) || !c.budget.withdraw() {
+			break
+		}
+		retryAttrs := []any{
+			slog.String("url", RedactURL(r.URL.String())),
+			slog.Int("attempt", attempt),
+		}
+		if err != nil {
+			retryAttrs = append(retryAttrs, slog.Any("error", err))
+		} else {
+			retryAttrs = append(retryAttrs, slog.Int("status", resp.StatusCode))
+		}
+		LoggerFromContext(r.Context()).WarnContext(r.Context(), "retrying frontier call", retryAttrs...)
+		if resp != nil {
+			// drain so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(c.policy.Backoff(attempt)):
+		}
+		if r.GetBody != nil {
+			body, bodyErr := r.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			r.Body = body
+		}
+	}
+	if err != nil && r.Context().Err() == nil && !errors.Is(err, ErrCircuitOpen) {
+		err = fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	return resp, err
+}
+
+func (c *ResilientHTTPClient) attempt(r *http.Request) (*http.Response, error) {
+	if c.breaker != nil && !c.breaker.Allow() {
+		LoggerFromContext(r.Context()).DebugContext(r.Context(), "frontier call skipped, circuit open",
+			slog.String("url", RedactURL(r.URL.String())))
+		return nil, ErrCircuitOpen
+	}
+
+	req := r
+	cancel := context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		var ctx context.Context
+		ctx, cancel = context.WithTimeout(r.Context(), c.timeout)
+		req = r.WithContext(ctx)
+	}
+	resp, err := c.client.Do(req)
+	if c.breaker != nil {
+		switch {
+		case err != nil && r.Context().Err() != nil:
+			// the caller gave up, frontier may well be healthy
+			c.breaker.Ignore()
+		case err != nil || resp.StatusCode >= http.StatusInternalServerError:
+			c.breaker.Failure()
+		default:
+			c.breaker.Success()
+		}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// keep the timeout context alive until caller is done reading the body
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+func (c *ResilientHTTPClient) shouldRetry(r *http.Request, resp *http.Response, err error) bool {
+	if c.policy == nil || r.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen)
+	}
+	return c.policy.isRetryableStatus(resp.StatusCode)
+}
+
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,182 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = pkg.RetryPolicy{
+	MaxAttempts:          3,
+	InitialBackoff:       time.Millisecond,
+	MaxBackoff:           time.Millisecond,
+	Multiplier:           2,
+	RetryableStatusCodes: []int{http.StatusServiceUnavailable},
+}
+
+// newFlakyServer fails the first failures calls with status and counts
+// every call it gets
+func newFlakyServer(t *testing.T, failures int, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	calls := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if int(calls.Add(1)) <= failures {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, calls
+}
+
+func TestResilientHTTPClientRetries(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		ctx       context.Context
+		failures  int
+		status    int
+		want      int
+		wantCalls int32
+	}{
+		{name: "transient failures of get", method: http.MethodGet, failures: 2, status: http.StatusServiceUnavailable,
+			want: http.StatusOK, wantCalls: 3},
+		{name: "attempts exhausted", method: http.MethodGet, failures: 3, status: http.StatusServiceUnavailable,
+			want: http.StatusServiceUnavailable, wantCalls: 3},
+		{name: "status not retryable", method: http.MethodGet, failures: 1, status: http.StatusInternalServerError,
+			want: http.StatusInternalServerError, wantCalls: 1},
+		{name: "post not retried", method: http.MethodPost, failures: 1, status: http.StatusServiceUnavailable,
+			want: http.StatusServiceUnavailable, wantCalls: 1},
+		{name: "idempotent post", method: http.MethodPost, ctx: pkg.WithIdempotent(context.Background()),
+			failures: 1, status: http.StatusServiceUnavailable, want: http.StatusOK, wantCalls: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := newFlakyServer(t, tt.failures, tt.status)
+			client := pkg.NewResilientHTTPClient(http.DefaultClient, pkg.WithRetryPolicy(testRetryPolicy))
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			req, err := http.NewRequestWithContext(ctx, tt.method, srv.URL, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("Do() error = %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.want || calls.Load() != tt.wantCalls {
+				t.Errorf("Do() = %d after %d calls, want %d after %d", resp.StatusCode, calls.Load(), tt.want, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestResilientHTTPClientRetryBudget(t *testing.T) {
+	srv, calls := newFlakyServer(t, 100, http.StatusServiceUnavailable)
+	policy := testRetryPolicy
+	policy.BudgetRatio = 0.1
+	policy.BudgetMinRetries = 1
+	client := pkg.NewResilientHTTPClient(http.DefaultClient, pkg.WithRetryPolicy(policy))
+
+	// the single retry always allowed is spent by the first call, the
+	// second hasn't earned one yet
+	for i, wantCalls := range []int32{2, 3} {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+		if calls.Load() != wantCalls {
+			t.Errorf("calls after request %d = %d, want %d", i, calls.Load(), wantCalls)
+		}
+	}
+}
+
+func TestResilientHTTPClientErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	client := pkg.NewResilientHTTPClient(http.DefaultClient, pkg.WithRetryPolicy(testRetryPolicy))
+	if _, err := client.Get(srv.URL); !errors.Is(err, pkg.ErrFrontierUnavailable) {
+		t.Errorf("Get() of closed server error = %v, want ErrFrontierUnavailable", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); !errors.Is(err, context.Canceled) || errors.Is(err, pkg.ErrFrontierUnavailable) {
+		t.Errorf("Do() with cancelled context error = %v, want only context.Canceled", err)
+	}
+}
+
+func TestResilientHTTPClientCircuitBreaker(t *testing.T) {
+	srv, calls := newFlakyServer(t, 100, http.StatusInternalServerError)
+	breaker := pkg.NewCircuitBreaker(2, time.Hour)
+	client := pkg.NewResilientHTTPClient(http.DefaultClient, pkg.WithCircuitBreaker(breaker))
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if _, err := client.Get(srv.URL); !errors.Is(err, pkg.ErrCircuitOpen) {
+		t.Errorf("Get() with open circuit error = %v, want ErrCircuitOpen", err)
+	}
+	if calls.Load() != 2 {
+		t.Errorf("calls = %d, want 2", calls.Load())
+	}
+}
+
+func TestResilientHTTPClientCancelledCallKeepsCircuitClosed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	breaker := pkg.NewCircuitBreaker(1, time.Hour)
+	client := pkg.NewResilientHTTPClient(http.DefaultClient, pkg.WithCircuitBreaker(breaker))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Do(req); err == nil {
+		t.Fatal("Do() error = nil, want deadline exceeded")
+	}
+	if state := breaker.State(); state != pkg.CircuitClosed {
+		t.Errorf("State() = %s, want closed", state)
+	}
+}
+
+func TestResilientHTTPClientCallTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	breaker := pkg.NewCircuitBreaker(1, time.Hour)
+	client := pkg.NewResilientHTTPClient(http.DefaultClient,
+		pkg.WithCallTimeout(10*time.Millisecond), pkg.WithCircuitBreaker(breaker))
+
+	// a call timing out is a frontier failure, unlike the caller giving up
+	if _, err := client.Get(srv.URL); !errors.Is(err, pkg.ErrFrontierUnavailable) {
+		t.Errorf("Get() error = %v, want ErrFrontierUnavailable", err)
+	}
+	if state := breaker.State(); state != pkg.CircuitOpen {
+		t.Errorf("State() = %s, want open", state)
+	}
+}
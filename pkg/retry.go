@@ -0,0 +1,133 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how calls to frontier are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts including the first one
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between retries
+	MaxBackoff time.Duration
+	// Multiplier grows the backoff after every retry
+	Multiplier float64
+	// Jitter randomizes backoff by up to this fraction, in [0, 1]
+	Jitter float64
+	// BudgetRatio limits retries to this fraction of total requests,
+	// zero disables the budget
+	BudgetRatio float64
+	// BudgetMinRetries is the number of retries always allowed
+	// regardless of the budget ratio
+	BudgetMinRetries int
+	// RetryableStatusCodes are http status codes considered transient
+	RetryableStatusCodes []int
+}
+
+// DefaultRetryPolicy retries transient failures up to 3 times in total
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      3,
+	InitialBackoff:   time.Millisecond * 100,
+	MaxBackoff:       time.Second * 2,
+	Multiplier:       2,
+	Jitter:           0.2,
+	BudgetRatio:      0.2,
+	BudgetMinRetries: 10,
+	RetryableStatusCodes: []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	},
+}
+
+// Backoff returns the wait duration before given retry attempt, starting at 1
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(retry-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff += backoff * p.Jitter * (rand.Float64()*2 - 1)
+	}
+	if backoff < 0 {
+		return 0
+	}
+	return time.Duration(backoff)
+}
+
+func (p RetryPolicy) isRetryableStatus(code int) bool {
+	for _, c := range p.RetryableStatusCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+type idempotentContextKey struct{}
+
+// WithIdempotent marks requests created with this context as safe to
+// retry even if their http method is not idempotent, e.g. POST /v1beta1/check
+func WithIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentContextKey{}, true)
+}
+
+// IsIdempotent reports if request can be safely retried
+func IsIdempotent(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	idempotent, _ := r.Context().Value(idempotentContextKey{}).(bool)
+	return idempotent
+}
+
+// retryBudget allows retries as long as they stay under a ratio of
+// requests seen, refilled as new requests come in
+type retryBudget struct {
+	mu     sync.Mutex
+	ratio  float64
+	max    float64
+	tokens float64
+}
+
+func newRetryBudget(ratio float64, minRetries int) *retryBudget {
+	if ratio <= 0 {
+		return nil
+	}
+	max := float64(minRetries)
+	if max < 1 {
+		max = 1
+	}
+	return &retryBudget{ratio: ratio, max: max, tokens: max}
+}
+
+func (b *retryBudget) deposit() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.max, b.tokens+b.ratio)
+}
+
+func (b *retryBudget) withdraw() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -0,0 +1,329 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	ServiceUserKeysPath = "/v1beta1/serviceusers/%s/keys"
+
+	// DefaultKeyRotationGracePeriod is how long the old key is kept after the
+	// new one is stored, so other replicas reload it before the old key stops
+	// verifying their tokens
+	DefaultKeyRotationGracePeriod = 5 * time.Minute
+
+	// rotationTokenTTL is the validity of tokens authenticating rotation calls
+	rotationTokenTTL = 5 * time.Minute
+	// rotationRollbackTimeout bounds a rollback, which runs even if the
+	// rotation was cancelled
+	rotationRollbackTimeout = 30 * time.Second
+)
+
+var ErrKeyRotation = errors.New("service user key rotation failed")
+
+// KeyRotationStep is a step of a service user key rotation
+type KeyRotationStep string
+
+const (
+	KeyRotationCreate = KeyRotationStep("create_key")
+	KeyRotationStore  = KeyRotationStep("store_key")
+	KeyRotationSwitch = KeyRotationStep("switch_key")
+	KeyRotationGrace  = KeyRotationStep("grace_period")
+	KeyRotationDelete = KeyRotationStep("delete_old_key")
+)
+
+// KeyRotationEvent reports progress of a rotation, it is sent once a step
+// is done or has failed with Err
+type KeyRotationEvent struct {
+	Step     KeyRotationStep
+	DryRun   bool
+	OldKeyID string
+	NewKeyID string
+	Err      error
+}
+
+// KeyRotator rotates the key of a service user through frontier api:
+//
+//  1. creates a new key, authenticated with the current one
+//  2. persists it through the CredentialStore
+//  3. switches token sources to the new key and checks frontier accepts it
+//  4. waits a grace period for other readers of the store to pick it up
+//  5. deletes the old key
+//
+// A failure before the grace period rolls back to the old key. The service
+// user must be allowed to manage its own keys.
+type KeyRotator struct {
+	client      HTTPClient
+	host        *url.URL
+	store       CredentialStore
+	gracePeriod time.Duration
+	keyTitle    string
+	dryRun      bool
+	progress    func(KeyRotationEvent)
+	switched    []TokenInvalidator
+}
+
+// WithRotationGracePeriod sets how long the old key is kept after switching
+func WithRotationGracePeriod(d time.Duration) func(*KeyRotator) {
+	return func(r *KeyRotator) {
+		r.gracePeriod = d
+	}
+}
+
+// WithRotationKeyTitle sets title of created keys
+func WithRotationKeyTitle(title string) func(*KeyRotator) {
+	return func(r *KeyRotator) {
+		r.keyTitle = title
+	}
+}
+
+// WithRotationDryRun only checks the current key is accepted by frontier
+// and reports the steps a rotation would take, nothing is changed
+func WithRotationDryRun() func(*KeyRotator) {
+	return func(r *KeyRotator) {
+		r.dryRun = true
+	}
+}
+
+// WithRotationProgress calls fn as steps complete or fail
+func WithRotationProgress(fn func(KeyRotationEvent)) func(*KeyRotator) {
+	return func(r *KeyRotator) {
+		r.progress = fn
+	}
+}
+
+// WithRotationTokenSources invalidates cached tokens of sources when
+// switching to the new key, e.g. ServiceUserTokenSource reading the store.
+// Otherwise they keep tokens of the old key until those expire.
+func WithRotationTokenSources(sources ...TokenInvalidator) func(*KeyRotator) {
+	return func(r *KeyRotator) {
+		r.switched = append(r.switched, sources...)
+	}
+}
+
+func NewKeyRotator(client HTTPClient, frontierHost *url.URL, store CredentialStore, opts ...func(*KeyRotator)) *KeyRotator {
+	r := &KeyRotator{
+		client:      client,
+		host:        frontierHost,
+		store:       store,
+		gracePeriod: DefaultKeyRotationGracePeriod,
+		keyTitle:    "rotated by frontier-go",
+		progress:    func(KeyRotationEvent) {},
+	}
+	for _, o := range opts {
+		o(r)
+	}
+	return r
+}
+
+// Rotate replaces the stored credential with a new key and returns it, in
+// dry run mode the current credential is returned. If ctx is done during
+// grace period the new key stays in use and the old one is not deleted.
+func (r *KeyRotator) Rotate(ctx context.Context) (credential *frontierv1beta1.KeyCredential, err error) {
+	ctx, span := StartSpan(ctx, "frontier.RotateServiceUserKey")
+	defer func() { EndSpan(span, err) }()
+
+	if r.host == nil {
+		return nil, ErrMissingHost
+	}
+	current, err := r.store.Credential(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := ValidateKeyCredential(current); err != nil {
+		return nil, err
+	}
+	span.SetAttributes(AttributePrincipal.String(current.GetPrincipalId()))
+	logger := LoggerFromContext(ctx).With(
+		slog.String("principal_id", current.GetPrincipalId()),
+		slog.String("old_kid", current.GetKid()),
+	)
+
+	if r.dryRun {
+		if err := r.verify(ctx, current); err != nil {
+			r.progress(KeyRotationEvent{Step: KeyRotationCreate, DryRun: true, OldKeyID: current.GetKid(), Err: err})
+			return nil, err
+		}
+		for _, step := range []KeyRotationStep{KeyRotationCreate, KeyRotationStore, KeyRotationSwitch, KeyRotationGrace, KeyRotationDelete} {
+			r.progress(KeyRotationEvent{Step: step, DryRun: true, OldKeyID: current.GetKid()})
+		}
+		return current, nil
+	}
+
+	created, err := r.createKey(ctx, current)
+	r.progress(KeyRotationEvent{Step: KeyRotationCreate, OldKeyID: current.GetKid(), NewKeyID: created.GetKid(), Err: err})
+	if err != nil {
+		return nil, err
+	}
+	event := KeyRotationEvent{OldKeyID: current.GetKid(), NewKeyID: created.GetKid()}
+	logger = logger.With(slog.String("new_kid", created.GetKid()))
+
+	// a key nobody can use is deleted right away, with the old key as
+	// frontier may have refused the new one. A cancelled rotation still
+	// has to clean up after itself.
+	rollback := func(restore bool) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rotationRollbackTimeout)
+		defer cancel()
+		if restore {
+			if err := r.store.Store(ctx, current); err != nil {
+				logger.ErrorContext(ctx, "failed to restore old service user key", slog.Any("error", err))
+			}
+			r.invalidate()
+		}
+		if err := r.deleteKey(ctx, current, created.GetKid()); err != nil {
+			logger.WarnContext(ctx, "failed to delete unused service user key", slog.Any("error", err))
+		}
+	}
+
+	event.Step, event.Err = KeyRotationStore, r.store.Store(ctx, created)
+	r.progress(event)
+	if event.Err != nil {
+		rollback(false)
+		return nil, event.Err
+	}
+
+	r.invalidate()
+	event.Step, event.Err = KeyRotationSwitch, r.verify(ctx, created)
+	r.progress(event)
+	if event.Err != nil {
+		rollback(true)
+		return nil, event.Err
+	}
+	logger.InfoContext(ctx, "switched to new service user key")
+
+	event.Step, event.Err = KeyRotationGrace, sleepContext(ctx, r.gracePeriod)
+	r.progress(event)
+	if event.Err != nil {
+		return created, fmt.Errorf("%w: old key %s not deleted: %w", ErrKeyRotation, current.GetKid(), event.Err)
+	}
+
+	event.Step, event.Err = KeyRotationDelete, r.deleteKey(ctx, created, current.GetKid())
+	r.progress(event)
+	if event.Err != nil {
+		return created, event.Err
+	}
+	logger.InfoContext(ctx, "deleted old service user key")
+	return created, nil
+}
+
+func (r *KeyRotator) invalidate() {
+	for _, ts := range r.switched {
+		ts.Invalidate()
+	}
+}
+
+// createKey creates a new key for service user of credential
+func (r *KeyRotator) createKey(ctx context.Context, credential *frontierv1beta1.KeyCredential) (*frontierv1beta1.KeyCredential, error) {
+	body, err := protojson.Marshal(&frontierv1beta1.CreateServiceUserKeyRequest{Title: r.keyTitle})
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.do(ctx, credential, http.MethodPost,
+		fmt.Sprintf(ServiceUserKeysPath, credential.GetPrincipalId()), body)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	createResp := &frontierv1beta1.CreateServiceUserKeyResponse{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, createResp); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	created := createResp.GetKey()
+	if created == nil {
+		return nil, fmt.Errorf("%w: no key in response", ErrUnexpectedResponse)
+	}
+	if created.GetPrincipalId() == "" {
+		created.PrincipalId = credential.GetPrincipalId()
+	}
+	if err := ValidateKeyCredential(created); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	return created, nil
+}
+
+// deleteKey deletes key kid of the service user, authenticated with credential
+func (r *KeyRotator) deleteKey(ctx context.Context, credential *frontierv1beta1.KeyCredential, kid string) error {
+	resp, err := r.do(WithIdempotent(ctx), credential, http.MethodDelete,
+		fmt.Sprintf(ServiceUserPublicKeyPath, credential.GetPrincipalId(), kid), nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// verify checks frontier authenticates requests signed with credential
+func (r *KeyRotator) verify(ctx context.Context, credential *frontierv1beta1.KeyCredential) error {
+	resp, err := r.do(WithIdempotent(ctx), credential, http.MethodGet, CurrentUserProfilePath, nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// do sends a request authenticated with credential, non 2xx responses are
+// returned as errors
+func (r *KeyRotator) do(ctx context.Context, credential *frontierv1beta1.KeyCredential,
+	method, path string, body []byte) (*http.Response, error) {
+	generator, err := GetServiceUserTokenGenerator(credential, WithTokenTTL(rotationTokenTTL))
+	if err != nil {
+		return nil, err
+	}
+	token, err := generator()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method,
+		r.host.ResolveReference(&url.URL{Path: path}).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+string(token))
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	InjectTraceContext(ctx, req.Header)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return nil, fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+		}
+		return nil, fmt.Errorf("%w: %s %s returned %s", ErrKeyRotation, method, path, resp.Status)
+	}
+	return resp, nil
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
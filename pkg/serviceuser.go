@@ -1,92 +1,318 @@
 package pkg
 
 import (
-	"crypto/rsa"
+	"context"
 	"fmt"
+	"github.com/google/uuid"
+	"github.com/lestrrat-go/jwx/v2/jwa"
 	"github.com/lestrrat-go/jwx/v2/jwk"
-	"github.com/raystack/frontier/pkg/utils"
+	"github.com/lestrrat-go/jwx/v2/jwt"
 	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
 	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/jws"
-	"google.golang.org/protobuf/encoding/protojson"
+	"sync"
 	"time"
 )
 
+const (
+	// ServiceUserTokenIssuer is set as issuer of tokens minted by the sdk
+	ServiceUserTokenIssuer = "//frontier-go-sdk"
+
+	DefaultServiceUserTokenTTL     = time.Hour
+	DefaultTokenRefreshMargin      = time.Minute
+	defaultServiceUserGeneratorTTL = time.Hour * 12
+)
+
+// Types of service user key credentials. Frontier only issues
+// KeyCredentialTypeRSA, the ECDSA and Ed25519 types are local to this sdk
+// and label credentials holding keys created elsewhere, e.g. by frontiertest.
+// Algorithm of minted tokens is picked from the key: RS256 for RSA, ES256,
+// ES384 or ES512 by curve for ECDSA and EdDSA for Ed25519 keys.
+const (
+	KeyCredentialTypeRSA     = "sv_rsa"
+	KeyCredentialTypeECDSA   = "sv_ec"
+	KeyCredentialTypeEd25519 = "sv_ed25519"
+)
+
+// credentialKeyTypes maps credential types to the key type they must hold
+var credentialKeyTypes = map[string]jwa.KeyType{
+	KeyCredentialTypeRSA:     jwa.RSA,
+	KeyCredentialTypeECDSA:   jwa.EC,
+	KeyCredentialTypeEd25519: jwa.OKP,
+}
+
 type ServiceUserTokenGenerator func() ([]byte, error)
 
-func GetServiceUserTokenGenerator(credential *frontierv1beta1.KeyCredential) (ServiceUserTokenGenerator, error) {
+// ServiceUserTokenOptions configures tokens minted for a service user
+type ServiceUserTokenOptions struct {
+	// Audience is set as aud claim if not empty
+	Audience []string
+	// TTL is the validity of each token
+	TTL time.Duration
+	// MaxTTL caps TTL if positive. Frontier accepts a service user token
+	// for as long as it is valid and its key exists, so a cap keeps tokens
+	// from outliving the revocation policy of the caller.
+	MaxTTL time.Duration
+	// NotBefore is added to issue time to set nbf claim, a negative
+	// value tolerates clock skew between the caller and frontier
+	NotBefore time.Duration
+	// TokenID generates jti claim of each token, no jti is set if nil
+	TokenID func() string
+	// Claims are added to every token, e.g. target org or scopes.
+	// Registered claims set by the sdk like sub, kid and exp are rejected.
+	Claims map[string]any
+	// RefreshMargin is how long before expiry a token source mints
+	// a new token, so tokens don't expire in flight
+	RefreshMargin time.Duration
+}
+
+// WithTokenAudience sets aud claim of minted tokens
+func WithTokenAudience(audience ...string) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.Audience = audience
+	}
+}
+
+// WithTokenTTL sets validity of minted tokens
+func WithTokenTTL(ttl time.Duration) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.TTL = ttl
+	}
+}
+
+// WithTokenMaxTTL rejects options with a ttl longer than max
+func WithTokenMaxTTL(max time.Duration) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.MaxTTL = max
+	}
+}
+
+// WithTokenNotBefore sets nbf claim to issue time plus offset
+func WithTokenNotBefore(offset time.Duration) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.NotBefore = offset
+	}
+}
+
+// WithTokenID sets generator of jti claim, nil omits the claim.
+// Defaults to a random uuid.
+func WithTokenID(generate func() string) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.TokenID = generate
+	}
+}
+
+// WithTokenClaims adds claims to minted tokens
+func WithTokenClaims(claims map[string]any) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.Claims = claims
+	}
+}
+
+// WithTokenRefreshMargin makes token source mint a new token margin
+// before the current one expires
+func WithTokenRefreshMargin(margin time.Duration) func(*ServiceUserTokenOptions) {
+	return func(o *ServiceUserTokenOptions) {
+		o.RefreshMargin = margin
+	}
+}
+
+// Validate checks tokens minted with options would be accepted
+func (o ServiceUserTokenOptions) Validate() error {
+	switch {
+	case o.TTL <= 0:
+		return fmt.Errorf("%w: token ttl must be positive, got %s", ErrInvalidTokenOptions, o.TTL)
+	case o.MaxTTL > 0 && o.TTL > o.MaxTTL:
+		return fmt.Errorf("%w: token ttl %s exceeds maximum of %s", ErrInvalidTokenOptions, o.TTL, o.MaxTTL)
+	case o.NotBefore >= o.TTL:
+		return fmt.Errorf("%w: not before offset %s must be less than ttl %s", ErrInvalidTokenOptions, o.NotBefore, o.TTL)
+	case o.RefreshMargin < 0:
+		return fmt.Errorf("%w: refresh margin must not be negative, got %s", ErrInvalidTokenOptions, o.RefreshMargin)
+	}
+	for _, name := range registeredClaims {
+		if _, ok := o.Claims[name]; ok {
+			return fmt.Errorf("%w: claim %q is set by the sdk", ErrInvalidTokenOptions, name)
+		}
+	}
+	return nil
+}
+
+// registeredClaims are set on every minted token
+var registeredClaims = []string{
+	jwt.IssuerKey, jwt.SubjectKey, jwt.AudienceKey, jwt.ExpirationKey,
+	jwt.NotBeforeKey, jwt.IssuedAtKey, jwt.JwtIDKey, jwk.KeyIDKey,
+}
+
+func newServiceUserTokenOptions(ttl time.Duration, opts ...func(*ServiceUserTokenOptions)) (ServiceUserTokenOptions, error) {
+	o := ServiceUserTokenOptions{
+		TTL:     ttl,
+		TokenID: func() string { return uuid.New().String() },
+	}
+	for _, fn := range opts {
+		fn(&o)
+	}
+	return o, o.Validate()
+}
+
+// GetServiceUserTokenGenerator returns a func minting a new token signed by
+// credential key on every call, tokens are valid for 12 hours unless
+// configured otherwise. Prefer NewServiceUserTokenSource which reuses tokens.
+func GetServiceUserTokenGenerator(credential *frontierv1beta1.KeyCredential,
+	opts ...func(*ServiceUserTokenOptions)) (ServiceUserTokenGenerator, error) {
 	// generate a token out of key
-	rsaKey, err := jwk.ParseKey([]byte(credential.GetPrivateKey()), jwk.WithPEM(true))
+	signer, err := NewCredentialSigner(credential)
 	if err != nil {
 		return nil, err
 	}
-	if err = rsaKey.Set(jwk.KeyIDKey, credential.GetKid()); err != nil {
+	return GetServiceUserTokenGeneratorForSigner(credential.GetPrincipalId(), signer, opts...)
+}
+
+// GetServiceUserTokenGeneratorForSigner is GetServiceUserTokenGenerator
+// for a service user key held by signer
+func GetServiceUserTokenGeneratorForSigner(principalID string, signer Signer,
+	opts ...func(*ServiceUserTokenOptions)) (ServiceUserTokenGenerator, error) {
+	tokenOpts, err := newServiceUserTokenOptions(defaultServiceUserGeneratorTTL, opts...)
+	if err != nil {
 		return nil, err
 	}
 	return func() ([]byte, error) {
-		return utils.BuildToken(rsaKey, "//frontier-go-sdk", credential.GetPrincipalId(), time.Hour*12, nil)
+		token, _, err := buildServiceUserToken(signer, principalID, tokenOpts)
+		return token, err
 	}, nil
 }
 
-func newJWTSource(jsonKey []byte, audience string) (oauth2.TokenSource, error) {
-	if audience == "" {
-		return nil, fmt.Errorf("missing audience for JWT access token")
-	}
+// ServiceUserTokenSource is an oauth2.TokenSource minting tokens signed by
+// a service user key. A token is reused until it is about to expire or the
+// credential provider returns a rotated key. It is safe for concurrent use,
+// wrap it with oauth2.NewClient or use it as grpc per rpc credentials.
+type ServiceUserTokenSource struct {
+	// provider is nil for a source created from a signer
+	provider CredentialProvider
+	opts     ServiceUserTokenOptions
+
+	mu          sync.Mutex
+	principalID string
+	signer      Signer
+	token       *oauth2.Token
+}
 
-	keyCred := &frontierv1beta1.KeyCredential{}
-	err := protojson.Unmarshal(jsonKey, keyCred)
+// NewServiceUserTokenSource creates a token source for credential, tokens
+// are valid for DefaultServiceUserTokenTTL unless configured otherwise
+func NewServiceUserTokenSource(credential *frontierv1beta1.KeyCredential,
+	opts ...func(*ServiceUserTokenOptions)) (*ServiceUserTokenSource, error) {
+	provider, err := NewStaticCredentialProvider(credential)
 	if err != nil {
-		return nil, fmt.Errorf("could not parse JSON key: %v", err)
+		return nil, err
 	}
-	parsedKey, err := jwk.ParseKey([]byte(keyCred.PrivateKey), jwk.WithPEM(true))
-	if err != nil {
-		return nil, fmt.Errorf("could not parse key: %v", err)
+	return NewServiceUserTokenSourceFromProvider(provider, opts...)
+}
+
+// NewServiceUserTokenSourceFromProvider creates a token source picking up
+// keys rotated by provider
+func NewServiceUserTokenSourceFromProvider(provider CredentialProvider,
+	opts ...func(*ServiceUserTokenOptions)) (*ServiceUserTokenSource, error) {
+	return newServiceUserTokenSource(&ServiceUserTokenSource{provider: provider}, opts...)
+}
+
+// NewServiceUserTokenSourceFromSigner creates a token source for service
+// user principalID with its key held by signer, e.g. in a KMS
+func NewServiceUserTokenSourceFromSigner(principalID string, signer Signer,
+	opts ...func(*ServiceUserTokenOptions)) (*ServiceUserTokenSource, error) {
+	if signer == nil {
+		return nil, fmt.Errorf("%w: missing signer", ErrInvalidCredential)
 	}
-	pk := &rsa.PrivateKey{}
-	err = parsedKey.Raw(pk)
+	return newServiceUserTokenSource(&ServiceUserTokenSource{principalID: principalID, signer: signer}, opts...)
+}
+
+func newServiceUserTokenSource(s *ServiceUserTokenSource, opts ...func(*ServiceUserTokenOptions)) (*ServiceUserTokenSource, error) {
+	tokenOpts, err := newServiceUserTokenOptions(DefaultServiceUserTokenTTL,
+		append([]func(*ServiceUserTokenOptions){WithTokenRefreshMargin(DefaultTokenRefreshMargin)}, opts...)...)
 	if err != nil {
-		return nil, fmt.Errorf("could not extract private key: %v", err)
+		return nil, err
+	}
+	if tokenOpts.TTL <= tokenOpts.RefreshMargin {
+		return nil, fmt.Errorf("%w: token ttl %s must be greater than refresh margin %s",
+			ErrInvalidTokenOptions, tokenOpts.TTL, tokenOpts.RefreshMargin)
+	}
+	s.opts = tokenOpts
+	// mint the first token upfront so a bad key fails early
+	if _, err := s.Token(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Token returns a valid token, minting a new one if needed
+func (s *ServiceUserTokenSource) Token() (*oauth2.Token, error) {
+	var credential *frontierv1beta1.KeyCredential
+	if s.provider != nil {
+		var err error
+		if credential, err = s.provider.Credential(context.Background()); err != nil {
+			return nil, err
+		}
+		if err := ValidateKeyCredential(credential); err != nil {
+			return nil, err
+		}
 	}
 
-	ts := &jwtAccessTokenSource{
-		principal: keyCred.PrincipalId,
-		audience:  audience,
-		pk:        pk,
-		pkID:      keyCred.Kid,
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotated := credential != nil && (s.signer == nil || s.signer.KeyID() != credential.GetKid())
+	if !rotated && s.token != nil && time.Until(s.token.Expiry) > s.opts.RefreshMargin {
+		return s.token, nil
 	}
-	tok, err := ts.Token()
+	if rotated {
+		signer, err := NewCredentialSigner(credential)
+		if err != nil {
+			return nil, err
+		}
+		s.signer, s.principalID = signer, credential.GetPrincipalId()
+	}
+	token, expiry, err := buildServiceUserToken(s.signer, s.principalID, s.opts)
 	if err != nil {
 		return nil, err
 	}
-	rts := oauth2.ReuseTokenSource(tok, ts)
-	return rts, nil
+	s.token = &oauth2.Token{AccessToken: string(token), TokenType: "Bearer", Expiry: expiry}
+	return s.token, nil
 }
 
-type jwtAccessTokenSource struct {
-	principal string
-	audience  string
-	pk        *rsa.PrivateKey
-	pkID      string
+// Invalidate drops the cached token, next call to Token mints a new one
+func (s *ServiceUserTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.token = nil
 }
 
-func (ts *jwtAccessTokenSource) Token() (*oauth2.Token, error) {
-	iat := time.Now()
-	exp := iat.Add(time.Hour)
-	cs := &jws.ClaimSet{
-		Iss: ts.principal,
-		Sub: ts.principal,
-		Aud: ts.audience,
-		Iat: iat.Unix(),
-		Exp: exp.Unix(),
+// buildServiceUserToken signs a token for principal in the form frontier
+// expects, kid is set as a claim to look up the service user key
+func buildServiceUserToken(signer Signer, principalID string, opts ServiceUserTokenOptions) ([]byte, time.Time, error) {
+	now := time.Now().UTC()
+	expiry := now.Add(opts.TTL)
+	builder := jwt.NewBuilder()
+	for name, value := range opts.Claims {
+		builder = builder.Claim(name, value)
+	}
+	builder = builder.
+		Issuer(ServiceUserTokenIssuer).
+		IssuedAt(now).
+		NotBefore(now.Add(opts.NotBefore)).
+		Expiration(expiry).
+		Subject(principalID).
+		Claim(jwk.KeyIDKey, signer.KeyID())
+	if opts.TokenID != nil {
+		if id := opts.TokenID(); id != "" {
+			builder = builder.JwtID(id)
+		}
 	}
-	hdr := &jws.Header{
-		Algorithm: "RS256",
-		Typ:       "JWT",
-		KeyID:     ts.pkID,
+	if len(opts.Audience) > 0 {
+		builder = builder.Audience(opts.Audience)
+	}
+	token, err := builder.Build()
+	if err != nil {
+		return nil, time.Time{}, err
 	}
-	msg, err := jws.Encode(hdr, cs, ts.pk)
+	signed, err := signToken(token, signer)
 	if err != nil {
-		return nil, fmt.Errorf("could not encode JWT: %v", err)
+		return nil, time.Time{}, err
 	}
-	return &oauth2.Token{AccessToken: msg, TokenType: "Bearer", Expiry: exp}, nil
+	return signed, expiry, nil
 }
@@ -0,0 +1,32 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"testing"
+)
+
+// credentialFunc is a pkg.CredentialProvider returning whatever fn does
+type credentialFunc func() (*frontierv1beta1.KeyCredential, error)
+
+func (fn credentialFunc) Credential(context.Context) (*frontierv1beta1.KeyCredential, error) {
+	return fn()
+}
+
+func TestServiceUserTokenSourceRejectsMissingCredentials(t *testing.T) {
+	if _, err := pkg.NewStaticCredentialProvider(nil); !errors.Is(err, pkg.ErrInvalidCredential) {
+		t.Errorf("NewStaticCredentialProvider(nil) error = %v, want ErrInvalidCredential", err)
+	}
+	if _, err := pkg.NewServiceUserTokenSource(&frontierv1beta1.KeyCredential{Kid: "kid"}); !errors.Is(err, pkg.ErrInvalidCredential) {
+		t.Errorf("NewServiceUserTokenSource() without key error = %v, want ErrInvalidCredential", err)
+	}
+	provider := credentialFunc(func() (*frontierv1beta1.KeyCredential, error) { return nil, nil })
+	if _, err := pkg.NewServiceUserTokenSourceFromProvider(provider); !errors.Is(err, pkg.ErrInvalidCredential) {
+		t.Errorf("NewServiceUserTokenSourceFromProvider() of empty provider error = %v, want ErrInvalidCredential", err)
+	}
+	if _, err := pkg.NewServiceUserTokenSourceFromSigner("service-user-1", nil); !errors.Is(err, pkg.ErrInvalidCredential) {
+		t.Errorf("NewServiceUserTokenSourceFromSigner() without signer error = %v, want ErrInvalidCredential", err)
+	}
+}
@@ -0,0 +1,169 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"math/big"
+)
+
+// Signer signs service user tokens with a key that may never leave a KMS
+// or HSM. Sign gets the JWS signing input and returns the signature in
+// JWS form, e.g. r || s for ECDSA.
+type Signer interface {
+	// KeyID is the id of service user key in frontier
+	KeyID() string
+	Algorithm() jwa.SignatureAlgorithm
+	Sign(payload []byte) ([]byte, error)
+}
+
+// cryptoSigner adapts a crypto.Signer to sign tokens
+type cryptoSigner struct {
+	kid    string
+	alg    jwa.SignatureAlgorithm
+	hash   crypto.Hash
+	signer crypto.Signer
+	// keySize is byte length of r and s in ECDSA signatures
+	keySize int
+}
+
+// NewCryptoSigner adapts signer holding service user key kid, e.g. one
+// backed by a cloud KMS or PKCS#11. Algorithm is picked from its public
+// key the same way as for key credentials.
+func NewCryptoSigner(kid string, signer crypto.Signer) (Signer, error) {
+	alg, err := signatureAlgorithm(signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	s := &cryptoSigner{kid: kid, alg: alg, signer: signer}
+	switch alg {
+	case jwa.RS256, jwa.ES256:
+		s.hash = crypto.SHA256
+	case jwa.ES384:
+		s.hash = crypto.SHA384
+	case jwa.ES512:
+		s.hash = crypto.SHA512
+	}
+	if pub, ok := signer.Public().(*ecdsa.PublicKey); ok {
+		s.keySize = (pub.Curve.Params().BitSize + 7) / 8
+	}
+	return s, nil
+}
+
+// NewCredentialSigner signs with the private key of credential in memory
+func NewCredentialSigner(credential *frontierv1beta1.KeyCredential) (Signer, error) {
+	key, err := jwk.ParseKey([]byte(credential.GetPrivateKey()), jwk.WithPEM(true))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	if want, ok := credentialKeyTypes[credential.GetType()]; ok && key.KeyType() != want {
+		return nil, fmt.Errorf("%w: credential of type %s holds %s key",
+			ErrInvalidCredential, credential.GetType(), key.KeyType())
+	}
+	var raw any
+	if err := key.Raw(&raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredential, err)
+	}
+	signer, ok := raw.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s key is not a private key", ErrInvalidCredential, key.KeyType())
+	}
+	return NewCryptoSigner(credential.GetKid(), signer)
+}
+
+func (s *cryptoSigner) KeyID() string {
+	return s.kid
+}
+
+func (s *cryptoSigner) Algorithm() jwa.SignatureAlgorithm {
+	return s.alg
+}
+
+func (s *cryptoSigner) Sign(payload []byte) ([]byte, error) {
+	digest := payload
+	if s.hash != 0 {
+		h := s.hash.New()
+		h.Write(payload)
+		digest = h.Sum(nil)
+	}
+	signature, err := s.signer.Sign(rand.Reader, digest, s.hash)
+	if err != nil {
+		return nil, err
+	}
+	if s.keySize == 0 {
+		return signature, nil
+	}
+	// crypto.Signer returns ASN.1 encoded ECDSA signatures, JWS wants the
+	// fixed size concatenation of r and s
+	var parsed struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse ecdsa signature: %w", err)
+	}
+	out := make([]byte, 2*s.keySize)
+	parsed.R.FillBytes(out[:s.keySize])
+	parsed.S.FillBytes(out[s.keySize:])
+	return out, nil
+}
+
+// signatureAlgorithm picks the algorithm to sign tokens with key: RS256 for
+// RSA, ES256, ES384 or ES512 by curve for ECDSA and EdDSA for Ed25519
+func signatureAlgorithm(key crypto.PublicKey) (jwa.SignatureAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return jwa.RS256, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwa.ES256, nil
+		case elliptic.P384():
+			return jwa.ES384, nil
+		case elliptic.P521():
+			return jwa.ES512, nil
+		}
+		return "", fmt.Errorf("%w: unsupported curve %s", ErrInvalidCredential, k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return jwa.EdDSA, nil
+	}
+	return "", fmt.Errorf("%w: unsupported key type %T", ErrInvalidCredential, key)
+}
+
+// signToken serializes token as a compact JWS signed by signer
+func signToken(token jwt.Token, signer Signer) ([]byte, error) {
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.AlgorithmKey, signer.Algorithm()); err != nil {
+		return nil, err
+	}
+	if err := headers.Set(jws.KeyIDKey, signer.KeyID()); err != nil {
+		return nil, err
+	}
+	if err := headers.Set(jws.TypeKey, "JWT"); err != nil {
+		return nil, err
+	}
+	rawHeaders, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return nil, err
+	}
+	input := base64.RawURLEncoding.EncodeToString(rawHeaders) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	signature, err := signer.Sign([]byte(input))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign token: %w", err)
+	}
+	return []byte(input + "." + base64.RawURLEncoding.EncodeToString(signature)), nil
+}
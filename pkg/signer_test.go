@@ -0,0 +1,119 @@
+package pkg_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/lestrrat-go/jwx/v2/jwa"
+	"github.com/lestrrat-go/jwx/v2/jws"
+	"github.com/lestrrat-go/jwx/v2/jwt"
+	"github.com/raystack/frontier-go/pkg"
+	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"testing"
+)
+
+func privateKeyPEM(t *testing.T, key crypto.Signer) string {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	generateECDSA := func(curve elliptic.Curve) func() (crypto.Signer, error) {
+		return func() (crypto.Signer, error) { return ecdsa.GenerateKey(curve, rand.Reader) }
+	}
+	tests := []struct {
+		name     string
+		typ      string
+		generate func() (crypto.Signer, error)
+		wantAlg  jwa.SignatureAlgorithm
+	}{
+		{name: "rsa", typ: pkg.KeyCredentialTypeRSA, wantAlg: jwa.RS256,
+			generate: func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) }},
+		{name: "ecdsa p256", typ: pkg.KeyCredentialTypeECDSA, wantAlg: jwa.ES256, generate: generateECDSA(elliptic.P256())},
+		{name: "ecdsa p384", typ: pkg.KeyCredentialTypeECDSA, wantAlg: jwa.ES384, generate: generateECDSA(elliptic.P384())},
+		{name: "ecdsa p521", typ: pkg.KeyCredentialTypeECDSA, wantAlg: jwa.ES512, generate: generateECDSA(elliptic.P521())},
+		{name: "ed25519", typ: pkg.KeyCredentialTypeEd25519, wantAlg: jwa.EdDSA,
+			generate: func() (crypto.Signer, error) {
+				_, key, err := ed25519.GenerateKey(rand.Reader)
+				return key, err
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := tt.generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			credential := &frontierv1beta1.KeyCredential{
+				Type:        tt.typ,
+				Kid:         "kid-1",
+				PrincipalId: "service-user-1",
+				PrivateKey:  privateKeyPEM(t, key),
+			}
+			signer, err := pkg.NewCredentialSigner(credential)
+			if err != nil {
+				t.Fatalf("NewCredentialSigner() error = %v", err)
+			}
+			if signer.Algorithm() != tt.wantAlg || signer.KeyID() != "kid-1" {
+				t.Errorf("signer = %s %s, want %s kid-1", signer.Algorithm(), signer.KeyID(), tt.wantAlg)
+			}
+
+			generate, err := pkg.GetServiceUserTokenGenerator(credential)
+			if err != nil {
+				t.Fatalf("GetServiceUserTokenGenerator() error = %v", err)
+			}
+			signed, err := generate()
+			if err != nil {
+				t.Fatalf("generate() error = %v", err)
+			}
+			token, err := jwt.Parse(signed, jwt.WithKey(tt.wantAlg, key.Public()))
+			if err != nil {
+				t.Fatalf("verifying token signed with %s: %v", tt.wantAlg, err)
+			}
+			if token.Subject() != "service-user-1" {
+				t.Errorf("token sub = %q, want service-user-1", token.Subject())
+			}
+			msg, err := jws.Parse(signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			headers := msg.Signatures()[0].ProtectedHeaders()
+			if headers.Algorithm() != tt.wantAlg || headers.KeyID() != "kid-1" {
+				t.Errorf("token headers = %s %s, want %s kid-1", headers.Algorithm(), headers.KeyID(), tt.wantAlg)
+			}
+		})
+	}
+}
+
+func TestSignerRejectsUnsupportedKeys(t *testing.T) {
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pkg.NewCryptoSigner("kid-1", p224); !errors.Is(err, pkg.ErrInvalidCredential) {
+		t.Errorf("NewCryptoSigner() with P-224 key error = %v, want ErrInvalidCredential", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, credential := range []*frontierv1beta1.KeyCredential{
+		{Type: pkg.KeyCredentialTypeECDSA, Kid: "kid-1", PrincipalId: "service-user-1", PrivateKey: privateKeyPEM(t, rsaKey)},
+		{Type: pkg.KeyCredentialTypeRSA, Kid: "kid-1", PrincipalId: "service-user-1", PrivateKey: "not a key"},
+	} {
+		if _, err := pkg.NewCredentialSigner(credential); !errors.Is(err, pkg.ErrInvalidCredential) {
+			t.Errorf("NewCredentialSigner(%s) error = %v, want ErrInvalidCredential", credential.GetType(), err)
+		}
+	}
+}
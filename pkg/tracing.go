@@ -0,0 +1,51 @@
+package pkg
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// TracerName is the instrumentation name used for all spans created by this sdk
+const TracerName = "github.com/raystack/frontier-go"
+
+var (
+	AttributeResource   = attribute.Key("frontier.resource")
+	AttributePermission = attribute.Key("frontier.permission")
+	AttributeDecision   = attribute.Key("frontier.decision")
+	AttributeCacheHit   = attribute.Key("frontier.cache_hit")
+	AttributePrincipal  = attribute.Key("frontier.principal.id")
+	AttributeKeyID      = attribute.Key("frontier.key.id")
+)
+
+// StartSpan starts a span using the tracer provider of the span already
+// in ctx, falling back to the global provider when there is none.
+// This keeps sdk spans in the same pipeline as the caller's.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tp := otel.GetTracerProvider()
+	if parent := trace.SpanFromContext(ctx); parent.SpanContext().IsValid() {
+		tp = parent.TracerProvider()
+	}
+	return tp.Tracer(TracerName).Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// EndSpan records err on span if any and ends it
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectTraceContext propagates trace context of ctx into outgoing request headers
+func InjectTraceContext(ctx context.Context, headers http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(headers))
+}
@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/oauth2"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	ErrNoCredentials    = errors.New("no token to authenticate request")
+	ErrHostNotAllowed   = errors.New("host is not allowed to receive tokens")
+	ErrNoTransportHosts = errors.New("no hosts allowed to receive tokens")
+)
+
+type principalTokenContextKey struct{}
+
+// ContextWithPrincipalToken attaches token of the principal a request is
+// served for, middleware does this for authenticated requests
+func ContextWithPrincipalToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, principalTokenContextKey{}, token)
+}
+
+// PrincipalTokenFromContext returns token attached with ContextWithPrincipalToken
+func PrincipalTokenFromContext(ctx context.Context) (string, bool) {
+	token, ok := ctx.Value(principalTokenContextKey{}).(string)
+	return token, ok && token != ""
+}
+
+// TokenInvalidator is implemented by token sources able to drop their
+// cached token, so the next one is freshly minted
+type TokenInvalidator interface {
+	Invalidate()
+}
+
+// Transport is an http.RoundTripper authenticating outbound calls to
+// frontier protected services with a bearer token. Tokens are only sent to
+// allowed hosts, see WithTransportHosts. Requests already carrying an
+// Authorization header are sent as is, unless redirected to another host.
+//
+//	ts, _ := pkg.NewServiceUserTokenSource(credential)
+//	transport, _ := pkg.NewTransport(nil,
+//		pkg.WithTransportTokenSource(ts), pkg.WithTransportHosts("api.example.com"))
+//	httpClient := &http.Client{Transport: transport}
+type Transport struct {
+	base             http.RoundTripper
+	tokenSource      oauth2.TokenSource
+	forwardPrincipal bool
+	hosts            []string
+}
+
+// WithTransportTokenSource authenticates requests with tokens of ts, usually
+// a ServiceUserTokenSource. A request rejected with 401 is retried once
+// with a fresh token if ts implements TokenInvalidator.
+func WithTransportTokenSource(ts oauth2.TokenSource) func(*Transport) {
+	return func(t *Transport) {
+		t.tokenSource = ts
+	}
+}
+
+// WithPrincipalForwarding sends the token of the principal found in request
+// context instead, so the callee sees the original caller. Token source is
+// used for requests made outside an authenticated request.
+func WithPrincipalForwarding() func(*Transport) {
+	return func(t *Transport) {
+		t.forwardPrincipal = true
+	}
+}
+
+// WithTransportHosts sets the hosts tokens are sent to, it is required. A
+// host without port matches any port of it.
+func WithTransportHosts(hosts ...string) func(*Transport) {
+	return func(t *Transport) {
+		t.hosts = hosts
+	}
+}
+
+// NewTransport wraps base, http.DefaultTransport if nil. It fails with
+// ErrNoTransportHosts unless hosts are set with WithTransportHosts.
+func NewTransport(base http.RoundTripper, opts ...func(*Transport)) (*Transport, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{base: base}
+	for _, o := range opts {
+		o(t)
+	}
+	if len(t.hosts) == 0 {
+		return nil, ErrNoTransportHosts
+	}
+	return t, nil
+}
+
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if !t.allowed(r.URL) {
+		// http.Client follows redirects with headers of the original
+		// request, a token for one host must not reach another
+		if r.Response != nil && r.Header.Get("Authorization") != "" {
+			clone := r.Clone(r.Context())
+			clone.Header.Del("Authorization")
+			return t.base.RoundTrip(clone)
+		}
+		if r.Response != nil || r.Header.Get("Authorization") != "" {
+			return t.base.RoundTrip(r)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, r.URL.Host)
+	}
+	if r.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(r)
+	}
+	if t.forwardPrincipal {
+		if token, ok := PrincipalTokenFromContext(r.Context()); ok {
+			return t.base.RoundTrip(withBearer(r, token))
+		}
+	}
+	if t.tokenSource == nil {
+		return nil, ErrNoCredentials
+	}
+
+	token, err := t.tokenSource.Token()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.base.RoundTrip(withBearer(r, token.AccessToken))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// token may have been revoked or its key rotated, retry once with a
+	// fresh one if the body can be sent again
+	invalidator, ok := t.tokenSource.(TokenInvalidator)
+	if !ok || (r.Body != nil && r.Body != http.NoBody && r.GetBody == nil) {
+		return resp, nil
+	}
+	invalidator.Invalidate()
+	token, err = t.tokenSource.Token()
+	if err != nil {
+		return resp, nil
+	}
+	retry := withBearer(r, token.AccessToken)
+	if r.GetBody != nil {
+		if retry.Body, err = r.GetBody(); err != nil {
+			return resp, nil
+		}
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+	LoggerFromContext(r.Context()).DebugContext(r.Context(), "retrying request rejected as unauthorized with a fresh token")
+	return t.base.RoundTrip(retry)
+}
+
+// allowed reports if tokens may be sent to host of u
+func (t *Transport) allowed(u *url.URL) bool {
+	for _, host := range t.hosts {
+		if _, _, err := net.SplitHostPort(host); err == nil {
+			if strings.EqualFold(host, u.Host) {
+				return true
+			}
+		} else if strings.EqualFold(strings.Trim(host, "[]"), u.Hostname()) {
+			return true
+		}
+	}
+	return false
+}
+
+// withBearer returns a copy of r authenticated with token, a RoundTripper
+// must not modify the request it was given
+func withBearer(r *http.Request, token string) *http.Request {
+	clone := r.Clone(r.Context())
+	clone.Header.Set("Authorization", "Bearer "+token)
+	return clone
+}
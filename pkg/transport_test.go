@@ -0,0 +1,192 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raystack/frontier-go/pkg"
+	"golang.org/x/oauth2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rotatingTokenSource hands out stale until invalidated, then fresh
+type rotatingTokenSource struct {
+	mu          sync.Mutex
+	invalidated bool
+}
+
+func (s *rotatingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.invalidated {
+		return &oauth2.Token{AccessToken: "fresh"}, nil
+	}
+	return &oauth2.Token{AccessToken: "stale"}, nil
+}
+
+func (s *rotatingTokenSource) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.invalidated = true
+}
+
+// newAuthRecordingServer records Authorization headers it receives
+func newAuthRecordingServer(t *testing.T, handler http.HandlerFunc) (*httptest.Server, func() []string) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		received = append(received, r.Header.Get("Authorization"))
+		mu.Unlock()
+		if handler != nil {
+			handler(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), received...)
+	}
+}
+
+func newTestTransport(t *testing.T, opts ...func(*pkg.Transport)) *http.Client {
+	t.Helper()
+	transport, err := pkg.NewTransport(nil, opts...)
+	if err != nil {
+		t.Fatalf("NewTransport() error = %v", err)
+	}
+	return &http.Client{Transport: transport}
+}
+
+func TestTransportRequiresHosts(t *testing.T) {
+	if _, err := pkg.NewTransport(nil, pkg.WithTransportTokenSource(&rotatingTokenSource{})); !errors.Is(err, pkg.ErrNoTransportHosts) {
+		t.Errorf("NewTransport() error = %v, want ErrNoTransportHosts", err)
+	}
+}
+
+func TestTransportHostAllowList(t *testing.T) {
+	srv, received := newAuthRecordingServer(t, nil)
+	host, _ := url.Parse(srv.URL)
+
+	tests := []struct {
+		name    string
+		hosts   []string
+		wantErr error
+	}{
+		{name: "host with port", hosts: []string{host.Host}},
+		{name: "host without port", hosts: []string{host.Hostname()}},
+		{name: "other port", hosts: []string{host.Hostname() + ":1"}, wantErr: pkg.ErrHostNotAllowed},
+		{name: "other host", hosts: []string{"api.example.com"}, wantErr: pkg.ErrHostNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestTransport(t, pkg.WithTransportTokenSource(&rotatingTokenSource{}),
+				pkg.WithTransportHosts(tt.hosts...))
+			before := len(received())
+			resp, err := client.Get(srv.URL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if len(received()) != before {
+					t.Error("request sent to a host not allowed")
+				}
+				return
+			}
+			resp.Body.Close()
+			if got := received()[before]; got != "Bearer stale" {
+				t.Errorf("Authorization = %q, want the token", got)
+			}
+		})
+	}
+}
+
+func TestTransportStripsAuthorizationOnCrossHostRedirect(t *testing.T) {
+	other, otherReceived := newAuthRecordingServer(t, nil)
+	allowed, _ := newAuthRecordingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, other.URL, http.StatusFound)
+	})
+	allowedHost, _ := url.Parse(allowed.URL)
+	client := newTestTransport(t, pkg.WithTransportTokenSource(&rotatingTokenSource{}),
+		pkg.WithTransportHosts(allowedHost.Host))
+
+	// a token set by the transport and one set by the caller
+	resp, err := client.Get(allowed.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	resp.Body.Close()
+	req, err := http.NewRequest(http.MethodGet, allowed.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer caller")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+
+	if got := otherReceived(); len(got) != 2 || got[0] != "" || got[1] != "" {
+		t.Errorf("Authorization received by redirect target = %q, want none", got)
+	}
+}
+
+func TestTransportRetriesUnauthorizedWithFreshToken(t *testing.T) {
+	var bodies []string
+	srv, received := newAuthRecordingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	host, _ := url.Parse(srv.URL)
+	client := newTestTransport(t, pkg.WithTransportTokenSource(&rotatingTokenSource{}),
+		pkg.WithTransportHosts(host.Host))
+
+	resp, err := client.Post(srv.URL, "application/json", strings.NewReader(`{"a":1}`))
+	if err != nil {
+		t.Fatalf("Post() error = %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Post() = %d, want 200", resp.StatusCode)
+	}
+	if got := received(); len(got) != 2 || got[0] != "Bearer stale" || got[1] != "Bearer fresh" {
+		t.Errorf("Authorization received = %q, want stale then fresh token", got)
+	}
+	if len(bodies) != 2 || bodies[1] != `{"a":1}` {
+		t.Errorf("bodies received = %q, want body sent again", bodies)
+	}
+}
+
+func TestTransportForwardsPrincipalToken(t *testing.T) {
+	srv, received := newAuthRecordingServer(t, nil)
+	host, _ := url.Parse(srv.URL)
+	client := newTestTransport(t, pkg.WithTransportTokenSource(&rotatingTokenSource{}),
+		pkg.WithPrincipalForwarding(), pkg.WithTransportHosts(host.Host))
+
+	ctx := pkg.ContextWithPrincipalToken(context.Background(), "principal")
+	for _, ctx := range []context.Context{ctx, context.Background()} {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Do() error = %v", err)
+		}
+		resp.Body.Close()
+	}
+	if got := received(); len(got) != 2 || got[0] != "Bearer principal" || got[1] != "Bearer stale" {
+		t.Errorf("Authorization received = %q, want principal then token source token", got)
+	}
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/lestrrat-go/jwx/v2/jwk"
+	"github.com/lestrrat-go/jwx/v2/jws"
 	"github.com/lestrrat-go/jwx/v2/jwt"
 	"github.com/raystack/frontier/pkg/server/consts"
 	frontierv1beta1 "github.com/raystack/frontier/proto/v1beta1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/url"
 	"strings"
@@ -16,9 +20,96 @@ import (
 const (
 	DefaultUserTokenHeader = consts.UserTokenRequestKey
 	DefaultSessionID       = consts.SessionRequestKey
+
+	AuthMethodBearer    = "bearer"
+	AuthMethodUserToken = "user_token"
+	AuthMethodSession   = "session"
+	AuthMethodNone      = "none"
+
+	PrincipalTypeUser        = "app/user"
+	PrincipalTypeServiceUser = "app/serviceuser"
+	// PrincipalTypeUnknown is returned for tokens that don't tell their
+	// principal type, see LookupPrincipalType
+	PrincipalTypeUnknown = ""
+
+	// generatedClaimKey is set by frontier on tokens it issues
+	generatedClaimKey   = "gen"
+	generatedClaimValue = "system"
 )
 
-func GetAuthenticatedUser(r *http.Request, httpClient HTTPClient, frontierHost *url.URL, frontierKeySet jwk.Set) (*frontierv1beta1.User, map[string]any, string, error) {
+// GetPrincipalType returns whether verified token claims belong to a user
+// or a service user. Only service users sign their own tokens, tokens
+// issued by frontier carry gen: system for users and service users alike,
+// e.g. after a token exchange, so for those PrincipalTypeUnknown is returned.
+func GetPrincipalType(claims map[string]any) string {
+	if gen, ok := claims[generatedClaimKey]; ok && gen == generatedClaimValue {
+		return PrincipalTypeUnknown
+	}
+	return PrincipalTypeServiceUser
+}
+
+// LookupPrincipalType asks frontier whether token belongs to a user or a
+// service user
+func LookupPrincipalType(ctx context.Context, client HTTPClient, frontierHost *url.URL, token string) (principalType string, err error) {
+	ctx, span := StartSpan(ctx, "frontier.LookupPrincipalType")
+	defer func() { EndSpan(span, err) }()
+
+	if frontierHost == nil {
+		return PrincipalTypeUnknown, ErrMissingHost
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		frontierHost.ResolveReference(&url.URL{Path: CurrentUserProfilePath}).String(), nil)
+	if err != nil {
+		return PrincipalTypeUnknown, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	InjectTraceContext(ctx, req.Header)
+	resp, err := client.Do(req)
+	if err != nil {
+		return PrincipalTypeUnknown, fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return PrincipalTypeUnknown, err
+	}
+	switch {
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return PrincipalTypeUnknown, fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+	case resp.StatusCode != http.StatusOK:
+		return PrincipalTypeUnknown, fmt.Errorf("%w: %s", ErrUnexpectedResponse, resp.Status)
+	}
+	current := &frontierv1beta1.GetCurrentUserResponse{}
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(raw, current); err != nil {
+		return PrincipalTypeUnknown, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	switch {
+	case current.GetServiceuser() != nil:
+		return PrincipalTypeServiceUser, nil
+	case current.GetUser() != nil:
+		return PrincipalTypeUser, nil
+	}
+	return PrincipalTypeUnknown, fmt.Errorf("%w: no principal in response", ErrUnexpectedResponse)
+}
+
+// GetAuthMethod returns the credential GetAuthenticatedUser will use for request
+func GetAuthMethod(r *http.Request) string {
+	if strings.HasPrefix(r.Header.Get("authorization"), "Bearer ") {
+		return AuthMethodBearer
+	}
+	if strings.TrimSpace(r.Header.Get(DefaultUserTokenHeader)) != "" {
+		return AuthMethodUserToken
+	}
+	if _, err := r.Cookie(DefaultSessionID); err == nil {
+		return AuthMethodSession
+	}
+	return AuthMethodNone
+}
+
+// GetRequestToken returns bearer token of request, falling back to the
+// frontier user token header
+func GetRequestToken(r *http.Request) string {
 	// check if context token is present
 	userToken := strings.TrimSpace(r.Header.Get(DefaultUserTokenHeader))
 	authHeader := r.Header.Get("authorization")
@@ -28,9 +119,31 @@ func GetAuthenticatedUser(r *http.Request, httpClient HTTPClient, frontierHost *
 			userToken = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 	}
+	return userToken
+}
+
+// KeySetFunc returns frontier keys to verify token with
+type KeySetFunc func(ctx context.Context, token string) (jwk.Set, error)
+
+func GetAuthenticatedUser(r *http.Request, httpClient HTTPClient, frontierHost *url.URL, frontierKeySet jwk.Set) (*frontierv1beta1.User, map[string]any, string, error) {
+	return GetAuthenticatedUserWithKeySetFunc(r, httpClient, frontierHost, func(context.Context, string) (jwk.Set, error) {
+		return frontierKeySet, nil
+	})
+}
+
+// GetAuthenticatedUserWithKeySetFunc is GetAuthenticatedUser getting frontier
+// keys for the token being verified, which for sessions is only known once
+// frontier returned it. This lets keys be refreshed on an unknown kid.
+func GetAuthenticatedUserWithKeySetFunc(r *http.Request, httpClient HTTPClient, frontierHost *url.URL,
+	frontierKeySet KeySetFunc) (*frontierv1beta1.User, map[string]any, string, error) {
+	userToken := GetRequestToken(r)
 	if userToken != "" {
 		// if present, verify token
-		claims, err := GetTokenClaims(r.Context(), httpClient, frontierHost, frontierKeySet, []byte(userToken))
+		keySet, err := frontierKeySet(r.Context(), userToken)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		claims, err := GetTokenClaims(r.Context(), httpClient, frontierHost, keySet, []byte(userToken))
 		if err != nil {
 			return nil, nil, "", err
 		}
@@ -45,11 +158,15 @@ func GetAuthenticatedUser(r *http.Request, httpClient HTTPClient, frontierHost *
 	// going via session route is slower then token route, but it also fetches full user profile
 	u, userToken, err := GetUserProfile(r.Context(), httpClient, frontierHost, r.Header)
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("%s : %w", ErrInvalidSession.Error(), err)
+		return nil, nil, "", fmt.Errorf("%w : %w", ErrInvalidSession, err)
+	}
+	keySet, err := frontierKeySet(r.Context(), userToken)
+	if err != nil {
+		return nil, nil, "", err
 	}
-	claims, err := GetTokenClaims(r.Context(), httpClient, frontierHost, frontierKeySet, []byte(userToken))
+	claims, err := GetTokenClaims(r.Context(), httpClient, frontierHost, keySet, []byte(userToken))
 	if err != nil {
-		return nil, nil, "", fmt.Errorf("%s : %w", ErrInvalidSession.Error(), err)
+		return nil, nil, "", fmt.Errorf("%w : %w", ErrInvalidSession, err)
 	}
 	return u, claims, userToken, nil
 }
@@ -57,33 +174,37 @@ func GetAuthenticatedUser(r *http.Request, httpClient HTTPClient, frontierHost *
 // GetTokenClaims parse & verify jwt with frontier public keys or user public keys
 func GetTokenClaims(ctx context.Context, httpClient HTTPClient, frontierHost *url.URL, frontierKeySet jwk.Set, userToken []byte) (map[string]any, error) {
 	var keySet = frontierKeySet
+	var keySetOpts []any
 
 	// check if token is created by frontier or user
 	insecureToken, err := jwt.ParseInsecure(userToken)
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", ErrInvalidToken.Error(), err)
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
-	if tokenType, ok := insecureToken.Get("gen"); !ok || tokenType != "system" {
-		// token is created by user, fetch user public keys
+	tokenType, ok := insecureToken.Get(generatedClaimKey)
+	if (!ok || tokenType != generatedClaimValue) && frontierHost != nil {
+		// token is created by user, fetch user public keys. Without a frontier
+		// host, e.g. with a static jwks, service user keys are expected to be
+		// part of frontierKeySet
 		kid, _ := insecureToken.Get(jwk.KeyIDKey)
 		keyUrl := fmt.Sprintf(ServiceUserPublicKeyPath, insecureToken.Subject(), kid)
 
 		// TODO(kushsharma): cache user public keys
-		userKeyResp, err := httpClient.Get(frontierHost.ResolveReference(&url.URL{Path: keyUrl}).String())
-		if err != nil {
-			return nil, fmt.Errorf("failed to fetch user public keys: %w", err)
-		}
-		// parse user public keys
-		keySet, err = jwk.ParseReader(userKeyResp.Body)
+		keySet, err = fetchServiceUserKeys(ctx, httpClient, frontierHost, keyUrl,
+			insecureToken.Subject(), fmt.Sprint(kid))
 		if err != nil {
 			return nil, err
 		}
+		keySetOpts = append(keySetOpts, jws.WithInferAlgorithmFromKey(true))
 	}
 
-	// verify token with jwks
-	verifiedToken, err := jwt.Parse(userToken, jwt.WithKeySet(keySet))
+	// frontier keys declare their alg, service user keys got theirs from
+	// their key type when fetched
+	verifiedToken, err := jwt.Parse(userToken, jwt.WithKeySet(keySet, keySetOpts...))
 	if err != nil {
-		return nil, fmt.Errorf("%s: %w", ErrInvalidToken.Error(), err)
+		LoggerFromContext(ctx).DebugContext(ctx, "token verification failed",
+			slog.String("token", RedactToken(string(userToken))), slog.Any("error", err))
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
 	}
 	tokenClaims, err := verifiedToken.AsMap(ctx)
 	if err != nil {
@@ -92,6 +213,75 @@ func GetTokenClaims(ctx context.Context, httpClient HTTPClient, frontierHost *ur
 	return tokenClaims, nil
 }
 
+// fetchServiceUserKeys fetches public keys of a service user from frontier
+func fetchServiceUserKeys(ctx context.Context, httpClient HTTPClient, frontierHost *url.URL,
+	keyPath, principalID, keyID string) (keySet jwk.Set, err error) {
+	ctx, span := StartSpan(ctx, "frontier.FetchServiceUserKeys",
+		AttributePrincipal.String(principalID),
+		AttributeKeyID.String(keyID),
+	)
+	defer func() { EndSpan(span, err) }()
+
+	if frontierHost == nil {
+		return nil, ErrMissingHost
+	}
+	keyRequest, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		frontierHost.ResolveReference(&url.URL{Path: keyPath}).String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	InjectTraceContext(ctx, keyRequest.Header)
+	userKeyResp, err := httpClient.Do(keyRequest)
+	if err != nil {
+		LoggerFromContext(ctx).DebugContext(ctx, "failed to fetch service user public keys",
+			slog.String("principal_id", principalID), slog.String("kid", keyID), slog.Any("error", err))
+		return nil, fmt.Errorf("%w: failed to fetch user public keys: %w", ErrFrontierUnavailable, err)
+	}
+	defer userKeyResp.Body.Close()
+
+	// any token can name an unknown service user or key, that makes it
+	// invalid rather than frontier failing
+	switch {
+	case userKeyResp.StatusCode >= http.StatusInternalServerError:
+		return nil, fmt.Errorf("%w: %s", ErrFrontierUnavailable, userKeyResp.Status)
+	case userKeyResp.StatusCode != http.StatusOK:
+		LoggerFromContext(ctx).DebugContext(ctx, "service user public keys not found",
+			slog.String("principal_id", principalID), slog.String("kid", keyID), slog.Int("status", userKeyResp.StatusCode))
+		return nil, fmt.Errorf("%w: service user key lookup returned %s", ErrInvalidToken, userKeyResp.Status)
+	}
+
+	// parse user public keys
+	keySet, err = jwk.ParseReader(userKeyResp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnexpectedResponse, err)
+	}
+	return keySet, setKeyAlgorithms(keySet)
+}
+
+// setKeyAlgorithms pins keys without alg to the algorithm service users
+// sign with for their key type, so a key isn't accepted for any algorithm
+// of its type
+func setKeyAlgorithms(keySet jwk.Set) error {
+	for i := 0; i < keySet.Len(); i++ {
+		key, _ := keySet.Key(i)
+		if key.Algorithm().String() != "" {
+			continue
+		}
+		var raw any
+		if err := key.Raw(&raw); err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		alg, err := signatureAlgorithm(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func GetUserFromClaims(claims map[string]any) *frontierv1beta1.User {
 	u := &frontierv1beta1.User{
 		Id: claims["sub"].(string),
@@ -106,20 +296,38 @@ func GetUserFromClaims(claims map[string]any) *frontierv1beta1.User {
 }
 
 // GetUserProfile fetches profile of authorized user from frontier server
-func GetUserProfile(ctx context.Context, client HTTPClient, frontierHost *url.URL, headers http.Header) (*frontierv1beta1.User, string, error) {
+func GetUserProfile(ctx context.Context, client HTTPClient, frontierHost *url.URL, headers http.Header) (user *frontierv1beta1.User, token string, err error) {
+	ctx, span := StartSpan(ctx, "frontier.GetUserProfile")
+	defer func() {
+		if user != nil {
+			span.SetAttributes(AttributePrincipal.String(user.GetId()))
+		}
+		EndSpan(span, err)
+	}()
+
+	if frontierHost == nil {
+		return nil, "", ErrMissingHost
+	}
 	getUserRequest, err := http.NewRequestWithContext(ctx, http.MethodGet,
 		frontierHost.ResolveReference(&url.URL{Path: CurrentUserProfilePath}).String(), nil)
 	if err != nil {
 		return nil, "", err
 	}
-	getUserRequest.Header = headers
+	getUserRequest.Header = headers.Clone()
+	InjectTraceContext(ctx, getUserRequest.Header)
 	resp, err := client.Do(getUserRequest)
 	if err != nil {
-		return nil, "", err
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier user profile call failed", slog.Any("error", err))
+		return nil, "", fmt.Errorf("%w: %w", ErrFrontierUnavailable, err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode >= http.StatusInternalServerError {
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier user profile call returned server error", slog.Int("status", resp.StatusCode))
+		return nil, "", fmt.Errorf("%w: %s", ErrFrontierUnavailable, resp.Status)
+	}
 	if resp.StatusCode != http.StatusOK {
+		LoggerFromContext(ctx).DebugContext(ctx, "frontier user profile call rejected", slog.Int("status", resp.StatusCode))
 		return nil, "", ErrInternalServer
 	}
 	currentUserResp := &frontierv1beta1.GetCurrentUserResponse{}
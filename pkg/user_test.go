@@ -0,0 +1,58 @@
+package pkg_test
+
+import (
+	"context"
+	"errors"
+	"github.com/raystack/frontier-go/frontiertest"
+	"github.com/raystack/frontier-go/pkg"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestGetTokenClaimsServiceUserKeyErrors(t *testing.T) {
+	fake := frontiertest.NewServer()
+	defer fake.Close()
+	credential, err := fake.RegisterServiceUser("service-user-1")
+	if err != nil {
+		t.Fatalf("RegisterServiceUser() error = %v", err)
+	}
+	token, err := fake.MintServiceUserToken(credential)
+	if err != nil {
+		t.Fatalf("MintServiceUserToken() error = %v", err)
+	}
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	unavailableHost, _ := url.Parse(unavailable.URL)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	closedHost, _ := url.Parse(closed.URL)
+
+	if _, err := pkg.GetTokenClaims(context.Background(), http.DefaultClient, fake.RESTEndpoint(),
+		fake.PublicKeys(), []byte(token)); err != nil {
+		t.Fatalf("GetTokenClaims() error = %v", err)
+	}
+	fake.DeleteServiceUserKey("service-user-1", credential.GetKid())
+
+	tests := []struct {
+		name string
+		host *url.URL
+		want error
+	}{
+		{name: "unknown key", host: fake.RESTEndpoint(), want: pkg.ErrInvalidToken},
+		{name: "frontier failing", host: unavailableHost, want: pkg.ErrFrontierUnavailable},
+		{name: "frontier unreachable", host: closedHost, want: pkg.ErrFrontierUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pkg.GetTokenClaims(context.Background(), http.DefaultClient, tt.host,
+				fake.PublicKeys(), []byte(token))
+			if !errors.Is(err, tt.want) {
+				t.Errorf("GetTokenClaims() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
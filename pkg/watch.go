@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// DefaultWatchInterval is how often watched files are checked for changes
+var DefaultWatchInterval = time.Second * 30
+
+// watchFile polls path for changes in modification time, size or the
+// file it resolves to and calls onChange until ctx is done. Polling is used over inotify so
+// atomically swapped symlinks, as done for kubernetes mounted
+// configmaps and secrets, are picked up as well.
+func watchFile(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	last, _ := os.Stat(path)
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				current, err := os.Stat(path)
+				if err != nil {
+					continue
+				}
+				if last == nil || !os.SameFile(current, last) ||
+					!current.ModTime().Equal(last.ModTime()) || current.Size() != last.Size() {
+					last = current
+					onChange()
+				}
+			}
+		}
+	}()
+}